@@ -1,52 +1,222 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"receipt-processor/internal/config"
 	"receipt-processor/internal/handler"
-	"strings"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/rules"
+	"receipt-processor/internal/store"
+	"receipt-processor/internal/validate"
+	"runtime"
+	"runtime/debug"
+	"syscall"
+	"time"
+)
+
+// Build details, set with -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD)".
+// When unset they are read from the build information the Go toolchain embeds.
+var (
+	version string
+	commit  string
 )
 
 func main() {
-	// Handles the "/receipts/process" route for processing receipts.
-	// Accepts only POST requests with Content-Type "application/json".
-	http.HandleFunc("/receipts/process", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+	cfg, printConfig, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if printConfig {
+		cfg.Print(os.Stdout)
+		return
+	}
+
+	ids, err := model.NewIDGenerator(cfg.IDs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	duplicatePolicy, err := handler.ParseDuplicatePolicy(cfg.Duplicates)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	reconcilePolicy, err := handler.ParseReconcilePolicy(cfg.Reconcile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tolerance, err := validate.ParseTolerance(cfg.ReconcileTolerance)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var zones model.Zones
+	if cfg.RetailerZones != "" {
+		zones, err = model.LoadZones(cfg.RetailerZones)
+		if err != nil {
+			log.Fatalf("Failed to load time zones: %v", err)
 		}
+	}
+	if cfg.TimeZone != "" {
+		zones.Default = cfg.TimeZone
+	}
+	if err := zones.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
-		if r.Header.Get("Content-Type") != "application/json" {
-			http.Error(w, "Content Type not allowed", http.StatusUnsupportedMediaType)
-			return
+	ruleSet := rules.Default()
+	if cfg.Rules != "" {
+		loaded, err := rules.Load(cfg.Rules)
+		if err != nil {
+			log.Fatalf("Failed to load rule set: %v", err)
 		}
+		ruleSet = loaded
+	}
 
-		handler.ProcessReceipt(w, r)
-	})
+	// Older rule set versions are kept loaded so receipts they scored can still be explained
+	var archived []*rules.RuleSet
+	if ruleSet.Version != rules.Default().Version {
+		archived = append(archived, rules.Default())
+	}
+	if cfg.RulesArchive != "" {
+		loaded, err := rules.LoadDir(cfg.RulesArchive)
+		if err != nil {
+			log.Fatalf("Failed to load archived rule sets: %v", err)
+		}
+		archived = append(archived, loaded...)
+	}
+	registry, err := rules.NewRegistry(ruleSet, archived...)
+	if err != nil {
+		log.Fatalf("Failed to load rule sets: %v", err)
+	}
 
-	// Handles the "/receipts/" route for getting points associated with a receipt ID.
-	// Accepts only GET requests.
-	http.HandleFunc("/receipts/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "GET" {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+	// Use the file-backed store when a data directory is given so receipts survive restarts
+	var receiptStore model.ReceiptStore = store.NewMemoryStore()
+	var fileStore *store.FileStore
+	if cfg.DataDir != "" {
+		fileStore, err = store.OpenFileStore(cfg.DataDir)
+		if err != nil {
+			log.Fatalf("Failed to open receipt store: %v", err)
 		}
+		receiptStore = fileStore
+	}
+	h := handler.New(receiptStore, registry, handler.Options{
+		IdempotencyWindow: cfg.IdempotencyWindow,
+		DuplicatePolicy:   duplicatePolicy,
+		IDs:               ids,
+		ReconcilePolicy:   reconcilePolicy,
+		Tolerance:         tolerance,
+		Zones:             zones,
+		MaxBodyBytes:      cfg.MaxBodyBytes,
+		Build:             buildInfo(),
+		AdminToken:        cfg.AdminToken,
+	})
+	if fileStore != nil {
+		h.Metrics().GaugeFunc("receipt_store_log_entries", "Entries in the write-ahead log since the last snapshot.", func() float64 {
+			return float64(fileStore.LogEntries())
+		})
+	}
 
-		// Extract the ID and optional "points" subpath from the URL
-		pathSegments := strings.Split(strings.TrimPrefix(r.URL.Path, "/receipts/"), "/")
-		id := pathSegments[0]
-		if id == "" {
-			http.Error(w, "Missing ID", http.StatusBadRequest)
-			return
+	server := &http.Server{
+		Addr:         cfg.Addr,
+		Handler:      h.Routes(),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	serveErr := serve(server, h.StartShutdown, cfg.ShutdownDelay, cfg.ShutdownTimeout)
+
+	// The store is closed only once no request can write to it any more
+	if fileStore != nil {
+		if err := fileStore.Close(); err != nil {
+			log.Printf("Failed to close receipt store: %v", err)
+			os.Exit(1)
 		}
+	}
+	if serveErr != nil {
+		log.Fatal(serveErr)
+	}
+	log.Print("Server stopped")
+}
 
-		// If there's a "points" subpath, call GetPoints; otherwise do not allow
-		if len(pathSegments) > 1 && pathSegments[1] == "points" {
-			handler.GetPoints(w, r, id)
-		} else {
-			http.Error(w, "Method or Path not allowed", http.StatusMethodNotAllowed)
+// serve runs the server on its address until it fails or the process receives SIGINT or SIGTERM.
+func serve(server *http.Server, startShutdown func(), delay, drain time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Restore default signal handling once a signal arrives, so a second one stops the process at once
+	context.AfterFunc(ctx, stop)
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Listening on %s", listener.Addr())
+	return run(ctx, server, listener, startShutdown, delay, drain)
+}
+
+// run serves connections from listener until the server fails or ctx is done. It then calls
+// startShutdown so readiness checks fail, keeps serving for delay so the orchestrator sees them
+// fail and stops routing here, and only then stops accepting connections. In-flight requests
+// get up to drain to finish before they are cut off.
+func run(ctx context.Context, server *http.Server, listener net.Listener, startShutdown func(), delay, drain time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Shutdown closes the listeners at once, so readiness must fail while they are still open
+	startShutdown()
+	if delay > 0 {
+		log.Printf("Shutting down, failing readiness checks for %s before draining", delay)
+		select {
+		case err := <-serveErr:
+			return err
+		case <-time.After(delay):
 		}
-	})
+	}
+
+	log.Printf("Shutting down, waiting up to %s for in-flight requests", drain)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("In-flight requests did not finish in time: %v", err)
+		server.Close()
+	}
+	return nil
+}
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// buildInfo describes the running binary from the link-time variables, falling back to the
+// module version and VCS revision embedded by the Go toolchain.
+func buildInfo() handler.BuildInfo {
+	info := handler.BuildInfo{Version: version, Commit: commit, GoVersion: runtime.Version()}
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = embedded.Main.Version
+		}
+		for _, setting := range embedded.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	return info
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"receipt-processor/internal/handler"
+	"receipt-processor/internal/rules"
+	"receipt-processor/internal/store"
+	"testing"
+	"time"
+)
+
+// Testing function for readiness failing while the server still answers, before it drains
+func TestRunFailsReadinessBeforeDraining(t *testing.T) {
+	registry, err := rules.NewRegistry(rules.Default())
+	if err != nil {
+		t.Fatalf("Failed to create rule registry: %v", err)
+	}
+	h := handler.New(store.NewMemoryStore(), registry, handler.Options{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	url := "http://" + listener.Addr().String() + "/readyz"
+
+	ctx, signal := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, &http.Server{Handler: h.Routes()}, listener, h.StartShutdown, 500*time.Millisecond, time.Second)
+	}()
+
+	readiness := func() int {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Readiness check failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := readiness(); code != http.StatusOK {
+		t.Fatalf("Expected 200 before the signal, got %d", code)
+	}
+
+	signal()
+	// The handler is marked at once, and the server keeps answering for the delay
+	time.Sleep(50 * time.Millisecond)
+	if code := readiness(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 during the shutdown delay, got %d", code)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Server did not shut down")
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Errorf("Expected the listener to be closed after shutdown")
+	}
+}
@@ -1,3 +1,5 @@
 module receipt-processor
 
 go 1.21.1
+
+require golang.org/x/text v0.22.0
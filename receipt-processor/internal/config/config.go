@@ -0,0 +1,234 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"receipt-processor/internal/handler"
+	"receipt-processor/internal/idempotency"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/validate"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the name of every environment variable the server reads, e.g. RECEIPTS_ADDR.
+const EnvPrefix = "RECEIPTS_"
+
+// Config is the server configuration. Every setting has a command-line flag; the same name is
+// used as the key in a config file and, upper-cased with EnvPrefix, as an environment variable.
+type Config struct {
+	Addr         string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	MaxBodyBytes int64
+
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+
+	DataDir      string
+	Rules        string
+	RulesArchive string
+
+	IdempotencyWindow  time.Duration
+	Duplicates         string
+	IDs                string
+	Reconcile          string
+	ReconcileTolerance string
+	TimeZone           string
+	RetailerZones      string
+
+	AdminToken string
+}
+
+// Default returns the configuration used when nothing else is given.
+func Default() Config {
+	return Config{
+		Addr:               ":8080",
+		ReadTimeout:        10 * time.Second,
+		WriteTimeout:       30 * time.Second,
+		IdleTimeout:        2 * time.Minute,
+		MaxBodyBytes:       1 << 20,
+		ShutdownDelay:      5 * time.Second,
+		ShutdownTimeout:    20 * time.Second,
+		IdempotencyWindow:  idempotency.DefaultWindow,
+		Duplicates:         string(handler.DuplicateAllow),
+		IDs:                "uuid",
+		Reconcile:          string(handler.ReconcileOff),
+		ReconcileTolerance: "15%",
+	}
+}
+
+// bind registers a flag for every setting, storing into c.
+func bind(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "address to listen on")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "maximum time to read a whole request")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "maximum time to write a response")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "how long an idle keep-alive connection is kept open")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", c.MaxBodyBytes, "largest request body accepted, in bytes")
+	fs.DurationVar(&c.ShutdownDelay, "shutdown-delay", c.ShutdownDelay, "how long to keep serving with readiness failing after SIGINT or SIGTERM, so load balancers stop routing here")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "how long in-flight requests may run after the shutdown delay before they are cut off")
+
+	fs.StringVar(&c.DataDir, "data", c.DataDir, "directory for durable receipt storage; receipts are kept in memory when empty")
+	fs.StringVar(&c.Rules, "rules", c.Rules, "JSON file with the scoring rule set; the built-in rules are used when empty")
+	fs.StringVar(&c.RulesArchive, "rules-archive", c.RulesArchive, "directory of older JSON rule sets kept for explaining previously scored receipts")
+
+	fs.DurationVar(&c.IdempotencyWindow, "idempotency-window", c.IdempotencyWindow, "how long Idempotency-Key headers are remembered; they survive restarts only with -data")
+	fs.StringVar(&c.Duplicates, "duplicates", c.Duplicates, "what to do with receipts whose content matches a stored one: allow, flag or reject")
+	fs.StringVar(&c.IDs, "ids", c.IDs, "kind of receipt IDs to generate: uuid or ulid (time-sortable)")
+	fs.StringVar(&c.Reconcile, "reconcile", c.Reconcile, "what to do with receipts whose total does not match the sum of their items: off, annotate, flag or reject")
+	fs.StringVar(&c.ReconcileTolerance, "reconcile-tolerance", c.ReconcileTolerance, "how far the total may be from the items sum, as an amount such as 2.00 or a percentage such as 15%")
+	fs.StringVar(&c.TimeZone, "time-zone", c.TimeZone, "IANA time zone of receipts that give none and whose retailer has none configured; UTC when empty")
+	fs.StringVar(&c.RetailerZones, "retailer-zones", c.RetailerZones, "JSON file mapping retailer names to IANA time zones")
+
+	fs.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "bearer token required by /admin endpoints, which are disabled when empty; prefer "+EnvPrefix+"ADMIN_TOKEN so it stays out of the process list")
+}
+
+// Load builds the configuration from, in increasing priority: the defaults, the JSON config file
+// named by -config or RECEIPTS_CONFIG, RECEIPTS_* environment variables, and command-line flags.
+// printConfig reports whether -print-config was given.
+func Load(args []string, lookupEnv func(string) (string, bool)) (c Config, printConfig bool, err error) {
+	// Parse the command line first to find the config file, but apply the flags last
+	parsed := Default()
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	bind(flags, &parsed)
+	path := flags.String("config", "", "JSON config file keyed by flag name; also read from "+EnvPrefix+"CONFIG")
+	flags.BoolVar(&printConfig, "print-config", false, "print the effective configuration as JSON and exit")
+	if err := flags.Parse(args); err != nil {
+		return Config{}, false, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, false, fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+
+	c = Default()
+	settings := flag.NewFlagSet("server", flag.ContinueOnError)
+	bind(settings, &c)
+
+	if *path == "" {
+		*path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if *path != "" {
+		if err := applyFile(settings, *path); err != nil {
+			return Config{}, false, err
+		}
+	}
+
+	var errs []error
+	settings.VisitAll(func(f *flag.Flag) {
+		name := EnvName(f.Name)
+		if value, ok := lookupEnv(name); ok {
+			if err := settings.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	})
+	flags.Visit(func(f *flag.Flag) {
+		if settings.Lookup(f.Name) != nil {
+			settings.Set(f.Name, f.Value.String())
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, false, err
+	}
+
+	return c, printConfig, c.Validate()
+}
+
+// EnvName returns the environment variable for a setting, e.g. RECEIPTS_READ_TIMEOUT for read-timeout.
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyFile sets every setting named in a JSON config file such as {"addr": ":9090", "read-timeout": "5s"}.
+func applyFile(settings *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: decode config file: %w", path, err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		raw := values[name]
+		if settings.Lookup(name) == nil {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, name))
+			continue
+		}
+		// Strings are unquoted; numbers and booleans are used as written
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(bytes.TrimSpace(raw))
+		}
+		if err := settings.Set(name, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks every setting and reports all that are invalid.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr is required"))
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.ShutdownDelay < 0 || c.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("timeouts must not be negative"))
+	}
+	if c.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("max-body-bytes must be positive"))
+	}
+	if c.IdempotencyWindow <= 0 {
+		errs = append(errs, errors.New("idempotency-window must be positive"))
+	}
+	if _, err := handler.ParseDuplicatePolicy(c.Duplicates); err != nil {
+		errs = append(errs, fmt.Errorf("duplicates: %w", err))
+	}
+	if _, err := model.NewIDGenerator(c.IDs); err != nil {
+		errs = append(errs, fmt.Errorf("ids: %w", err))
+	}
+	if _, err := handler.ParseReconcilePolicy(c.Reconcile); err != nil {
+		errs = append(errs, fmt.Errorf("reconcile: %w", err))
+	}
+	if _, err := validate.ParseTolerance(c.ReconcileTolerance); err != nil {
+		errs = append(errs, fmt.Errorf("reconcile-tolerance: %w", err))
+	}
+	if _, err := model.LoadZone(c.TimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("time-zone: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes the configuration as a JSON config file keyed by flag name. The admin token is redacted.
+func (c Config) Print(w io.Writer) error {
+	if c.AdminToken != "" {
+		c.AdminToken = "REDACTED"
+	}
+	settings := flag.NewFlagSet("server", flag.ContinueOnError)
+	bind(settings, &c)
+
+	values := make(map[string]string)
+	settings.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(values)
+}
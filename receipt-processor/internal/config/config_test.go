@@ -0,0 +1,122 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a lookup function over a fixed set of environment variables.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+// Testing function for layering the defaults, config file, environment and flags
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, `{"addr": ":9090", "read-timeout": "5s", "write-timeout": "5s", "max-body-bytes": 2048, "ids": "ulid"}`)
+	vars := map[string]string{
+		"RECEIPTS_CONFIG":        path,
+		"RECEIPTS_READ_TIMEOUT":  "7s",
+		"RECEIPTS_WRITE_TIMEOUT": "8s",
+	}
+
+	cfg, printConfig, err := config.Load([]string{"-write-timeout", "9s", "-print-config"}, env(vars))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !printConfig {
+		t.Errorf("Expected -print-config to be reported")
+	}
+
+	// Defaults, then the file, then the environment, then flags
+	if cfg.IdleTimeout != 2*time.Minute || cfg.Duplicates != "allow" {
+		t.Errorf("Expected defaults for unset settings, got %+v", cfg)
+	}
+	if cfg.Addr != ":9090" || cfg.MaxBodyBytes != 2048 || cfg.IDs != "ulid" {
+		t.Errorf("Expected settings from the config file, got %+v", cfg)
+	}
+	if cfg.ReadTimeout != 7*time.Second {
+		t.Errorf("Expected the environment to override the file, got read timeout %s", cfg.ReadTimeout)
+	}
+	if cfg.WriteTimeout != 9*time.Second {
+		t.Errorf("Expected flags to override the environment, got write timeout %s", cfg.WriteTimeout)
+	}
+
+	// The printed configuration can be read back as a config file
+	var printed bytes.Buffer
+	if err := cfg.Print(&printed); err != nil {
+		t.Fatalf("Print failed: %v", err)
+	}
+	reloaded, _, err := config.Load([]string{"-config", writeFile(t, printed.String())}, env(nil))
+	if err != nil || reloaded != cfg {
+		t.Errorf("Expected the printed configuration to reload as %+v, got %+v, %v", cfg, reloaded, err)
+	}
+}
+
+// Testing function for reporting every invalid setting
+func TestLoadInvalid(t *testing.T) {
+	testCases := []struct {
+		name   string
+		args   []string
+		vars   map[string]string
+		errMsg []string
+	}{
+		{"unknown file setting", []string{"-config", writeFile(t, `{"port": 8080}`)}, nil, []string{`unknown setting "port"`}},
+		{"bad environment value", nil, map[string]string{"RECEIPTS_IDLE_TIMEOUT": "soon"}, []string{"RECEIPTS_IDLE_TIMEOUT"}},
+		{"bad flag value", []string{"-max-body-bytes", "lots"}, nil, []string{"max-body-bytes"}},
+		{"stray argument", []string{"serve"}, nil, []string{"unexpected arguments"}},
+		{"negative timeout", []string{"-shutdown-timeout", "-1s"}, nil, []string{"timeouts must not be negative"}},
+		{
+			"several invalid settings",
+			[]string{"-addr", "", "-duplicates", "maybe", "-ids", "serial", "-reconcile-tolerance", "some", "-time-zone", "Nowhere/Special", "-max-body-bytes", "0"},
+			nil,
+			[]string{"addr is required", "duplicates:", "ids:", "reconcile-tolerance:", "time-zone:", "max-body-bytes must be positive"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := config.Load(tc.args, env(tc.vars))
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+			for _, msg := range tc.errMsg {
+				if !strings.Contains(err.Error(), msg) {
+					t.Errorf("Expected error to mention %q, got %v", msg, err)
+				}
+			}
+		})
+	}
+}
+
+// Testing function for keeping the admin token out of the printed configuration
+func TestPrintRedactsAdminToken(t *testing.T) {
+	cfg, _, err := config.Load(nil, env(map[string]string{"RECEIPTS_ADMIN_TOKEN": "s3cret"}))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.AdminToken != "s3cret" {
+		t.Errorf("Expected the admin token from the environment, got %q", cfg.AdminToken)
+	}
+
+	var printed bytes.Buffer
+	cfg.Print(&printed)
+	if strings.Contains(printed.String(), "s3cret") || !strings.Contains(printed.String(), `"admin-token": "REDACTED"`) {
+		t.Errorf("Expected the admin token to be redacted, got:\n%s", printed.String())
+	}
+}
@@ -1,102 +1,494 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"receipt-processor/internal/idempotency"
 	"receipt-processor/internal/model"
-	"regexp"
+	"receipt-processor/internal/rules"
+	"receipt-processor/internal/validate"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// IsValidPrice checks if a given price string is a valid price in terms of dollars and cents.
-func IsValidPrice(price string) bool {
-	// The price must start with one or more digits (\d+).
-	// Optionally, it can have a decimal point followed by exactly two digits (\.\d{2})
-	validPrice := regexp.MustCompile(`^\d+(\.\d{2})?$`)
-	return validPrice.MatchString(price)
+// DuplicatePolicy decides what happens when a submitted receipt has the same content as a stored one.
+type DuplicatePolicy string
+
+const (
+	// DuplicateAllow stores duplicates like any other receipt.
+	DuplicateAllow DuplicatePolicy = "allow"
+	// DuplicateFlag stores duplicates but marks them with the ID of the original receipt.
+	DuplicateFlag DuplicatePolicy = "flag"
+	// DuplicateReject refuses duplicates with 409 Conflict and the ID of the original receipt.
+	DuplicateReject DuplicatePolicy = "reject"
+)
+
+// ParseDuplicatePolicy checks that a policy name is one of allow, flag or reject.
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	switch policy := DuplicatePolicy(name); policy {
+	case DuplicateAllow, DuplicateFlag, DuplicateReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown duplicate policy %q: must be allow, flag or reject", name)
+}
+
+// ReconcilePolicy decides what happens when a receipt's total does not reconcile with the sum of its items.
+type ReconcilePolicy string
+
+const (
+	// ReconcileOff skips the reconciliation check.
+	ReconcileOff ReconcilePolicy = "off"
+	// ReconcileAnnotate stores mismatched receipts with the mismatch recorded on the stored record.
+	ReconcileAnnotate ReconcilePolicy = "annotate"
+	// ReconcileFlag annotates mismatched receipts and also reports the mismatch in the response.
+	ReconcileFlag ReconcilePolicy = "flag"
+	// ReconcileReject refuses mismatched receipts as invalid.
+	ReconcileReject ReconcilePolicy = "reject"
+)
+
+// ParseReconcilePolicy checks that a policy name is one of off, annotate, flag or reject.
+func ParseReconcilePolicy(name string) (ReconcilePolicy, error) {
+	switch policy := ReconcilePolicy(name); policy {
+	case ReconcileOff, ReconcileAnnotate, ReconcileFlag, ReconcileReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown reconcile policy %q: must be off, annotate, flag or reject", name)
+}
+
+// Options configures optional handler behavior. The zero value uses the defaults.
+type Options struct {
+	// IdempotencyWindow is how long an Idempotency-Key is remembered.
+	IdempotencyWindow time.Duration
+	// DuplicatePolicy decides how receipts with the same content as a stored one are handled.
+	// Empty means DuplicateAllow.
+	DuplicatePolicy DuplicatePolicy
+	// IDs generates receipt IDs. Nil means random UUIDs.
+	IDs model.IDGenerator
+	// ReconcilePolicy decides how receipts whose total does not match their items are handled.
+	// Empty means ReconcileOff.
+	ReconcilePolicy ReconcilePolicy
+	// Tolerance is how far the total may be from the items sum before it is a mismatch.
+	Tolerance validate.Tolerance
+	// Zones supplies the time zone of receipts that do not give one. The zero value means UTC.
+	Zones model.Zones
+	// MaxBodyBytes limits the size of request bodies. Zero means no limit.
+	MaxBodyBytes int64
+	// Build describes the running binary for the version endpoint.
+	Build BuildInfo
+	// AdminToken is the bearer token administration endpoints require. Empty disables them.
+	AdminToken string
+}
+
+// Handler serves the receipt endpoints using an injected ReceiptStore and registry of scoring rule sets.
+type Handler struct {
+	store           model.ReceiptStore
+	rules           *rules.Registry
+	idempotencyKeys *idempotency.Keys
+	duplicatePolicy DuplicatePolicy
+	ids             model.IDGenerator
+	reconcilePolicy ReconcilePolicy
+	tolerance       validate.Tolerance
+	zones           model.Zones
+	maxBodyBytes    int64
+	build           BuildInfo
+	adminToken      string
+	metrics         *handlerMetrics
+	shuttingDown    atomic.Bool // Set by StartShutdown; fails readiness checks
+	duplicateMu     sync.Mutex  // Serializes the duplicate check with storing so two copies can't both pass
+}
+
+// New creates a Handler that scores receipts with the registry's active rule set and stores them in the given store.
+func New(store model.ReceiptStore, registry *rules.Registry, options Options) *Handler {
+	if options.IDs == nil {
+		options.IDs = model.UUIDGenerator{}
+	}
+	// Keys stored with receipts outlive restarts, so retries across a deploy still get the original ID
+	keys := idempotency.NewKeys(options.IdempotencyWindow)
+	records, _ := store.List()
+	for _, record := range records {
+		if record.Idempotency != nil {
+			keys.Restore(record.Idempotency.Key, record.Idempotency.RequestHash, record.ID, record.CreatedAt)
+		}
+	}
+	return &Handler{
+		store:           store,
+		rules:           registry,
+		idempotencyKeys: keys,
+		duplicatePolicy: options.DuplicatePolicy,
+		ids:             options.IDs,
+		reconcilePolicy: options.ReconcilePolicy,
+		tolerance:       options.Tolerance,
+		zones:           options.Zones,
+		maxBodyBytes:    options.MaxBodyBytes,
+		build:           options.Build,
+		adminToken:      options.AdminToken,
+		metrics:         newHandlerMetrics(store),
+	}
+}
+
+// decodeReceipt reads and validates the receipt in a request body, collecting every invalid field.
+// On failure it writes a problem response and returns false.
+func (h *Handler) decodeReceipt(w http.ResponseWriter, r *http.Request) (model.Receipt, bool) {
+	receipt, errs, err := validate.Decode(r.Body, h.zones)
+	if err != nil {
+		writeBodyError(w, err, "The request body is not a valid receipt JSON document")
+		return model.Receipt{}, false
+	}
+
+	if len(errs) > 0 {
+		problem := NewProblem(http.StatusBadRequest, CodeInvalidReceipt, fmt.Sprintf("The receipt has %d invalid %s", len(errs), plural(len(errs), "field", "fields")))
+		problem.Errors = errs
+		problem.Write(w)
+		return model.Receipt{}, false
+	}
+	return receipt, true
+}
+
+// reconcile checks the receipt's total against its items under the reconcile policy and returns any
+// mismatch to record. When the policy rejects the mismatch it writes a problem response and returns false.
+func (h *Handler) reconcile(w http.ResponseWriter, receipt model.Receipt) (*model.TotalMismatch, bool) {
+	if h.reconcilePolicy == "" || h.reconcilePolicy == ReconcileOff {
+		return nil, true
+	}
+	mismatch := validate.Reconcile(receipt, h.tolerance)
+	if mismatch != nil && h.reconcilePolicy == ReconcileReject {
+		problem := NewProblem(http.StatusBadRequest, CodeInvalidReceipt, "The receipt total does not match the sum of its items")
+		problem.Errors = []validate.FieldError{validate.MismatchError(mismatch)}
+		problem.Write(w)
+		return nil, false
+	}
+	return mismatch, true
 }
 
 // ProcessReceipt handles HTTP requests for processing receipts. It validates the incoming receipt,
 // computes the points associated with it, and stores it.
+// A request carrying an Idempotency-Key header that repeats an earlier one with the same body gets the
+// original ID back instead of storing the receipt again; the same key with a different body is a conflict.
 // Responds with the receipt ID.
-func ProcessReceipt(w http.ResponseWriter, r *http.Request) {
-	var receipt model.Receipt
-	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
+func (h *Handler) ProcessReceipt(w http.ResponseWriter, r *http.Request) {
+	// Count refused receipts by the problem written for them
+	recorder := recordResponse(w)
+	w = recorder
+	defer func() {
+		if recorder.problem != nil {
+			h.metrics.recordRejected(*recorder.problem)
+		}
+	}()
+
+	key := r.Header.Get("Idempotency-Key")
+	var idem *model.Idempotency
+	if key != "" {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeBodyError(w, err, "The request body could not be read")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		idem = &model.Idempotency{Key: key, RequestHash: idempotency.Hash(body)}
+
+		outcome, receiptID := h.idempotencyKeys.Begin(key, body)
+		switch outcome {
+		case idempotency.Replayed:
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"id": receiptID})
+			return
+		case idempotency.Mismatch:
+			WriteProblem(w, http.StatusConflict, CodeIdempotencyKeyReused, "The idempotency key was already used with a different request")
+			return
+		case idempotency.InProgress:
+			WriteProblem(w, http.StatusConflict, CodeIdempotencyKeyInFlight, "A request with this idempotency key is still being processed")
+			return
+		}
 	}
 
-	// Check for empty strings
-	if receipt.Retailer == "" || receipt.PurchaseDate == "" || receipt.PurchaseTime == "" || len(receipt.Items) == 0 || receipt.Total == "" {
-		http.Error(w, "Missing or invalid fields", http.StatusBadRequest)
+	record, ok := h.storeReceipt(w, r, idem)
+	if key != "" {
+		if ok {
+			h.idempotencyKeys.Complete(key, record.ID)
+		} else {
+			h.idempotencyKeys.Abort(key)
+		}
+	}
+	if !ok {
 		return
 	}
 
-	// Check for invalid date
-	t, err := time.Parse("2006-01-02", receipt.PurchaseDate)
-	if err != nil {
-		http.Error(w, "Invalid date format", http.StatusBadRequest)
-		return
+	// Set response header and encode JSON
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]any{"id": record.ID}
+	if record.DuplicateOf != "" {
+		response["duplicateOf"] = record.DuplicateOf
+	}
+	if record.TotalMismatch != nil && h.reconcilePolicy == ReconcileFlag {
+		response["totalMismatch"] = record.TotalMismatch
 	}
+	json.NewEncoder(w).Encode(response)
+}
 
-	// Check for future date
-	if t.After(time.Now()) {
-		http.Error(w, "Date cannot be in the future", http.StatusBadRequest)
-		return
+// storeReceipt validates, scores and stores the receipt in a request body, applying the duplicate policy.
+// idem is stored with the receipt when the request has an Idempotency-Key.
+// On failure it writes the error response and returns false.
+func (h *Handler) storeReceipt(w http.ResponseWriter, r *http.Request, idem *model.Idempotency) (model.Record, bool) {
+	receipt, ok := h.decodeReceipt(w, r)
+	if !ok {
+		return model.Record{}, false
+	}
+	mismatch, ok := h.reconcile(w, receipt)
+	if !ok {
+		return model.Record{}, false
+	}
+
+	ruleSet := h.rules.Active()
+	breakdown := ruleSet.Breakdown(receipt)
+	record := model.Record{
+		Receipt:       receipt,
+		Points:        rules.Total(breakdown),
+		RuleVersion:   ruleSet.Version,
+		Fingerprint:   model.Fingerprint(receipt),
+		TotalMismatch: mismatch,
+		Idempotency:   idem,
 	}
 
-	// Check for invalid time
-	_, err = time.Parse("15:04", receipt.PurchaseTime)
+	if h.duplicatePolicy == DuplicateFlag || h.duplicatePolicy == DuplicateReject {
+		h.duplicateMu.Lock()
+		defer h.duplicateMu.Unlock()
+
+		if original, found := h.store.FindByFingerprint(record.Fingerprint); found {
+			if h.duplicatePolicy == DuplicateReject {
+				w.Header().Set("Location", "/receipts/"+original.ID)
+				problem := NewProblem(http.StatusConflict, CodeDuplicateReceipt, "A receipt with the same content was already submitted")
+				problem.DuplicateOf = original.ID
+				problem.Write(w)
+				return model.Record{}, false
+			}
+			record.DuplicateOf = original.ID
+		}
+	}
+
+	receiptID, err := model.StoreReceipt(h.store, h.ids, record)
 	if err != nil {
-		http.Error(w, "Invalid time format", http.StatusBadRequest)
+		WriteProblem(w, http.StatusInternalServerError, CodeStorageError, "The receipt could not be stored")
+		return model.Record{}, false
+	}
+	record.ID = receiptID
+	h.metrics.recordStored(record, breakdown)
+	return record, true
+}
+
+// ScoreReceipt handles HTTP requests for previewing the points a receipt would earn.
+// It runs the same validation and scoring as ProcessReceipt but stores nothing.
+// Responds with the points, the rule set version, the per-rule breakdown and any total mismatch.
+func (h *Handler) ScoreReceipt(w http.ResponseWriter, r *http.Request) {
+	receipt, ok := h.decodeReceipt(w, r)
+	if !ok {
+		return
+	}
+	mismatch, ok := h.reconcile(w, receipt)
+	if !ok {
 		return
 	}
 
-	for _, item := range receipt.Items {
-		// Check for correct price format
-		if !IsValidPrice(item.Price) {
-			http.Error(w, "Invalid Price Format", http.StatusBadRequest)
-			return
+	ruleSet := h.rules.Active()
+	breakdown := ruleSet.Breakdown(receipt)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Points        int                  `json:"points"`
+		RuleVersion   string               `json:"ruleVersion"`
+		Breakdown     []rules.Result       `json:"breakdown"`
+		TotalMismatch *model.TotalMismatch `json:"totalMismatch,omitempty"`
+	}{rules.Total(breakdown), ruleSet.Version, breakdown, mismatch})
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// ListReceipts handles HTTP requests for listing stored receipts. Optional query parameters filter by
+// retailer, purchaseDateFrom/purchaseDateTo, minTotal/maxTotal and minPoints/maxPoints; limit sets the
+// page size and cursor continues from the nextCursor of a previous page.
+// Responds with a page of receipts in ID order.
+func (h *Handler) ListReceipts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := model.Query{
+		Retailer: params.Get("retailer"),
+		DateFrom: params.Get("purchaseDateFrom"),
+		DateTo:   params.Get("purchaseDateTo"),
+		Limit:    defaultPageSize,
+	}
+
+	var errs []validate.FieldError
+
+	// Check for invalid dates
+	for name, date := range map[string]string{"purchaseDateFrom": query.DateFrom, "purchaseDateTo": query.DateTo} {
+		if date == "" {
+			continue
 		}
-		// Check for negative and zero prices in Items
-		price, err := strconv.ParseFloat(item.Price, 64)
-		if err != nil || price == 0 {
-			http.Error(w, "Zero Price error", http.StatusBadRequest)
-			return
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			errs = append(errs, validate.FieldError{Field: name, Code: validate.FieldInvalidDateFormat, Message: name + " must be a date such as \"2022-01-01\""})
+		}
+	}
+
+	// Check for invalid price bounds
+	for name, bound := range map[string]**model.Money{"minTotal": &query.MinTotal, "maxTotal": &query.MaxTotal} {
+		if value := params.Get(name); value != "" {
+			total, err := model.ParseMoney(value)
+			if err != nil {
+				errs = append(errs, validate.FieldError{Field: name, Code: validate.FieldInvalidPrice, Message: name + " must be a dollar amount such as \"6.49\""})
+				continue
+			}
+			*bound = &total
+		}
+	}
+
+	// Check for invalid points bounds
+	for name, bound := range map[string]**int{"minPoints": &query.MinPoints, "maxPoints": &query.MaxPoints} {
+		if value := params.Get(name); value != "" {
+			points, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, validate.FieldError{Field: name, Code: validate.FieldInvalidValue, Message: name + " must be a whole number"})
+				continue
+			}
+			*bound = &points
+		}
+	}
+
+	// Check for an invalid page size
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			errs = append(errs, validate.FieldError{Field: "limit", Code: validate.FieldInvalidValue, Message: fmt.Sprintf("limit must be between 1 and %d", maxPageSize)})
+		}
+		query.Limit = limit
+	}
+
+	// Check for a cursor that was not issued by a previous page
+	if cursor := params.Get("cursor"); cursor != "" {
+		after, err := model.DecodeCursor(cursor)
+		if err != nil {
+			errs = append(errs, validate.FieldError{Field: "cursor", Code: validate.FieldInvalidValue, Message: "cursor must be the nextCursor of a previous page"})
 		}
+		query.After = after
 	}
 
-	// Check for correct price format
-	if !IsValidPrice(receipt.Total) {
-		http.Error(w, "Invalid Price Format", http.StatusBadRequest)
+	if len(errs) > 0 {
+		// Map iteration order is random, so report fields in a stable order
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		problem := NewProblem(http.StatusBadRequest, CodeInvalidQuery, fmt.Sprintf("The query has %d invalid %s", len(errs), plural(len(errs), "parameter", "parameters")))
+		problem.Errors = errs
+		problem.Write(w)
 		return
 	}
 
-	// Check for negative or zero total price
-	totalPrice, err := strconv.ParseFloat(receipt.Total, 64)
-	if err != nil || totalPrice == 0 {
-		http.Error(w, "Zero Price error", http.StatusBadRequest)
+	page, err := h.store.Query(query)
+	if err != nil {
+		WriteProblem(w, http.StatusInternalServerError, CodeStorageError, "Receipts could not be listed")
 		return
 	}
 
-	receiptID := model.StoreReceipt(receipt)
+	// Idempotency keys belong to the clients that sent them
+	for i := range page.Records {
+		page.Records[i].Idempotency = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetReceipt handles HTTP requests for retrieving a stored receipt by ID.
+// Responds with the receipt, its points, the rule set version that scored it and when it was stored,
+// or an error if the ID is not found.
+func (h *Handler) GetReceipt(w http.ResponseWriter, r *http.Request, id string) {
+	record, ok := h.store.Get(id)
 
-	// Set response header and encode JSON
+	if !ok {
+		WriteProblem(w, http.StatusNotFound, CodeReceiptNotFound, "No receipt found for that id")
+		return
+	}
+
+	record.Idempotency = nil
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"id": receiptID})
+	json.NewEncoder(w).Encode(record)
 }
 
 // GetPoints handles HTTP requests for retrieving the points associated with a given receipt ID.
-// Responds with the points or an error if the ID is not found.
-func GetPoints(w http.ResponseWriter, r *http.Request, id string) {
-	points, ok := model.GetPoints(id)
+// Responds with the points and the rule set version that computed them, or an error if the ID is not found.
+func (h *Handler) GetPoints(w http.ResponseWriter, r *http.Request, id string) {
+	record, ok := h.store.Get(id)
+
+	if !ok {
+		WriteProblem(w, http.StatusNotFound, CodeReceiptNotFound, "No receipt found for that id")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Points      int    `json:"points"`
+		RuleVersion string `json:"ruleVersion"`
+	}{record.Points, record.RuleVersion})
+}
+
+// GetPointsBreakdown handles HTTP requests for the per-rule points breakdown of a given receipt ID.
+// The breakdown is computed with the rule set version that scored the receipt, not the active one.
+// Responds with the total points and what each scoring rule contributed, or an error if the ID is not found.
+func (h *Handler) GetPointsBreakdown(w http.ResponseWriter, r *http.Request, id string) {
+	record, ok := h.store.Get(id)
+
+	if !ok {
+		WriteProblem(w, http.StatusNotFound, CodeReceiptNotFound, "No receipt found for that id")
+		return
+	}
 
+	ruleSet, ok := h.rules.Get(record.RuleVersion)
 	if !ok {
-		http.Error(w, "No receipt found for that id", http.StatusNotFound)
+		WriteProblem(w, http.StatusConflict, CodeRuleSetNotLoaded, fmt.Sprintf("Rule set version %q that scored this receipt is not loaded", record.RuleVersion))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Points      int            `json:"points"`
+		RuleVersion string         `json:"ruleVersion"`
+		Breakdown   []rules.Result `json:"breakdown"`
+	}{record.Points, record.RuleVersion, ruleSet.Breakdown(record.Receipt)})
+}
+
+// Rescore handles admin HTTP requests to recompute the points of every stored receipt.
+// The request body names the rule set version to use (the active one when empty) and whether to commit.
+// Responds with the per-receipt deltas; new points are only stored when commit is true.
+func (h *Handler) Rescore(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RuleVersion string `json:"ruleVersion"`
+		Commit      bool   `json:"commit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBodyError(w, err, "The request body is not a valid rescore request")
+		return
+	}
+
+	ruleSet := h.rules.Active()
+	if request.RuleVersion != "" {
+		var ok bool
+		ruleSet, ok = h.rules.Get(request.RuleVersion)
+		if !ok {
+			WriteProblem(w, http.StatusNotFound, CodeUnknownRuleSet, fmt.Sprintf("Rule set version %q is not loaded", request.RuleVersion))
+			return
+		}
+	}
+
+	report, err := rules.Rescore(h.store, ruleSet, request.Commit)
+	if err != nil {
+		WriteProblem(w, http.StatusInternalServerError, CodeStorageError, "Receipts could not be rescored")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"points": points})
+	json.NewEncoder(w).Encode(report)
 }
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// BuildInfo describes the running server binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// StartShutdown marks the server as shutting down, so readiness checks fail and the orchestrator
+// stops sending new requests. It must be called while the server still accepts connections.
+func (h *Handler) StartShutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// Healthz handles liveness probes. It responds 200 OK whenever the process can serve requests at all.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Readyz handles readiness probes. It responds 200 OK when the store is open, a rule set is
+// loaded and the server is not shutting down, and 503 Service Unavailable listing the reasons otherwise.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	var reasons []string
+	if err := h.store.Ping(); err != nil {
+		reasons = append(reasons, "the receipt store is unavailable: "+err.Error())
+	}
+	if h.rules == nil || h.rules.Active() == nil {
+		reasons = append(reasons, "no rule set is loaded")
+	}
+	if h.shuttingDown.Load() {
+		reasons = append(reasons, "the server is shutting down")
+	}
+	if len(reasons) > 0 {
+		WriteProblem(w, http.StatusServiceUnavailable, CodeNotReady, "Not ready: "+strings.Join(reasons, "; "))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
+
+// Version handles requests for the build of the running server and the version of its active rule set.
+func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
+	build := h.build
+	if build.GoVersion == "" {
+		build.GoVersion = runtime.Version()
+	}
+	var ruleVersion string
+	if h.rules != nil && h.rules.Active() != nil {
+		ruleVersion = h.rules.Active().Version
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		BuildInfo
+		RuleVersion string `json:"ruleVersion"`
+	}{build, ruleVersion})
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+	"receipt-processor/internal/metrics"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/rules"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// pointsBuckets are the upper bounds of the points histogram.
+var pointsBuckets = []float64{0, 10, 25, 50, 75, 100, 150, 250, 500, 1000}
+
+// handlerMetrics are the metrics recorded while serving requests.
+type handlerMetrics struct {
+	registry  *metrics.Registry
+	processed *metrics.Counter
+	rejected  *metrics.Counter
+	points    *metrics.Histogram
+	ruleFires *metrics.Counter
+	latency   *metrics.Histogram
+}
+
+// newHandlerMetrics registers the handler's metrics, including the size of the store.
+func newHandlerMetrics(store model.ReceiptStore) *handlerMetrics {
+	registry := metrics.NewRegistry()
+	m := &handlerMetrics{
+		registry:  registry,
+		processed: registry.Counter("receipts_processed_total", "Receipts stored by POST /receipts/process."),
+		rejected: registry.Counter("receipts_rejected_total",
+			"Receipts refused by POST /receipts/process, by reason: the field error code for invalid receipts, otherwise the problem code.", "reason"),
+		points:    registry.Histogram("receipt_points", "Points awarded to stored receipts.", pointsBuckets),
+		ruleFires: registry.Counter("receipt_rule_fires_total", "Stored receipts each scoring rule awarded points to.", "rule"),
+		latency: registry.Histogram("http_request_duration_seconds",
+			"Time to serve requests, by method, route pattern and status code.", metrics.DefaultLatencyBuckets, "method", "route", "code"),
+	}
+	registry.GaugeFunc("receipts_stored", "Receipts in the store.", func() float64 {
+		return float64(store.Len())
+	})
+	return m
+}
+
+// recordStored counts a stored receipt, its points and the rules that awarded them.
+func (m *handlerMetrics) recordStored(record model.Record, breakdown []rules.Result) {
+	m.processed.Inc()
+	m.points.Observe(float64(record.Points))
+	for _, result := range breakdown {
+		if result.Points > 0 {
+			m.ruleFires.Inc(result.Rule)
+		}
+	}
+}
+
+// recordRejected counts a refused receipt once for each distinct reason in its problem.
+func (m *handlerMetrics) recordRejected(problem Problem) {
+	if len(problem.Errors) == 0 {
+		m.rejected.Inc(problem.Code)
+		return
+	}
+	reasons := make(map[string]bool)
+	for _, fieldErr := range problem.Errors {
+		reasons[fieldErr.Code] = true
+	}
+	codes := make([]string, 0, len(reasons))
+	for code := range reasons {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		m.rejected.Inc(code)
+	}
+}
+
+// recordRequest observes the latency of a request. route is the matched pattern, or empty when none matched.
+func (m *handlerMetrics) recordRequest(method, route string, status int, elapsed time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	m.latency.Observe(elapsed.Seconds(), method, route, strconv.Itoa(status))
+}
+
+// Metrics returns the registry holding the handler's metrics, so the server can add its own.
+func (h *Handler) Metrics() *metrics.Registry {
+	return h.metrics.registry
+}
+
+// GetMetrics handles scrapes of the metrics in the Prometheus text exposition format.
+func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	h.metrics.registry.Write(w)
+}
+
+// responseRecorder remembers the status code and any problem written through it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	problem *Problem
+}
+
+// recordResponse wraps w in a responseRecorder, reusing w if it already is one.
+func recordResponse(w http.ResponseWriter) *responseRecorder {
+	if recorder, ok := w.(*responseRecorder); ok {
+		return recorder
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// statusCode returns the status code written, which is 200 OK when the handler wrote nothing.
+func (rec *responseRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
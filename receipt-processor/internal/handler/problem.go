@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"receipt-processor/internal/validate"
+)
+
+// Stable error codes returned in problem responses
+const (
+	CodeInvalidJSON            = "invalid_json"
+	CodeInvalidReceipt         = "invalid_receipt"
+	CodeInvalidQuery           = "invalid_query"
+	CodeReceiptNotFound        = "receipt_not_found"
+	CodeRuleSetNotLoaded       = "rule_set_not_loaded"
+	CodeUnknownRuleSet         = "unknown_rule_set"
+	CodeDuplicateReceipt       = "duplicate_receipt"
+	CodeIdempotencyKeyReused   = "idempotency_key_reused"
+	CodeIdempotencyKeyInFlight = "idempotency_key_in_progress"
+	CodeStorageError           = "storage_error"
+	CodeMethodNotAllowed       = "method_not_allowed"
+	CodeUnsupportedMediaType   = "unsupported_media_type"
+	CodeBodyTooLarge           = "body_too_large"
+	CodeNotFound               = "not_found"
+	CodeNotReady               = "not_ready"
+	CodeUnauthorized           = "unauthorized"
+	CodeAdminDisabled          = "admin_disabled"
+)
+
+// Problem is an RFC 7807 problem details response body, extended with a stable error code,
+// the list of failing fields and, for duplicates, the ID of the original receipt.
+type Problem struct {
+	Type        string                `json:"type"`
+	Title       string                `json:"title"`
+	Status      int                   `json:"status"`
+	Detail      string                `json:"detail,omitempty"`
+	Code        string                `json:"code"`
+	Errors      []validate.FieldError `json:"errors,omitempty"`
+	DuplicateOf string                `json:"duplicateOf,omitempty"`
+}
+
+// NewProblem creates a problem whose type is derived from its code and whose title is the status text.
+func NewProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "urn:receipt-processor:problem:" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Write sends the problem as an application/problem+json response.
+func (p Problem) Write(w http.ResponseWriter) {
+	if recorder, ok := w.(*responseRecorder); ok {
+		recorder.problem = &p
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// WriteProblem sends a problem response with no field details.
+func WriteProblem(w http.ResponseWriter, status int, code, detail string) {
+	NewProblem(status, code, detail).Write(w)
+}
+
+// plural picks the singular or plural form of a word for a count.
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
+
+// writeBodyError reports a request body that could not be read or decoded, distinguishing
+// bodies cut off by the size limit from malformed ones.
+func writeBodyError(w http.ResponseWriter, err error, detail string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		WriteProblem(w, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("The request body is larger than %d bytes", tooLarge.Limit))
+		return
+	}
+	WriteProblem(w, http.StatusBadRequest, CodeInvalidJSON, detail)
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// params holds the values of the {name} segments of a matched route pattern.
+type params map[string]string
+
+// route is one method and path pattern, such as GET /receipts/{id}/points.
+type route struct {
+	method    string
+	pattern   string
+	segments  []string // literal segments, or "{name}" for a parameter
+	mediaType string   // media type the request body must have, or empty when there is no body
+	handle    func(w http.ResponseWriter, r *http.Request, p params)
+}
+
+// match reports whether the route's pattern matches the path segments, and extracts the parameters.
+func (rt route) match(segments []string) (params, bool) {
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+	p := params{}
+	for i, segment := range rt.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			p[segment[1:len(segment)-1]] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return p, true
+}
+
+// literals counts the literal segments of the route's pattern; patterns with more are more specific.
+func (rt route) literals() int {
+	n := 0
+	for _, segment := range rt.segments {
+		if !strings.HasPrefix(segment, "{") {
+			n++
+		}
+	}
+	return n
+}
+
+// router dispatches requests by method and path pattern. When several patterns match a path the
+// most specific one wins, so /receipts/process is never taken for /receipts/{id}. A path that no
+// pattern matches is 404 Not Found; a pattern without a route for the request method is
+// 405 Method Not Allowed with an Allow header. GET routes also answer HEAD.
+type router struct {
+	routes       []route
+	maxBodyBytes int64 // limit on request bodies, or zero for none
+	// observe, when set, is told the method, matched pattern, status code and duration of every
+	// request. Methods without a route are reported as "other", so clients cannot add series at will.
+	observe func(method, pattern string, status int, elapsed time.Duration)
+}
+
+// handle registers a route. mediaType is the Content-Type the request body must have, ignoring
+// parameters such as charset, or empty for routes without a body.
+func (rr *router) handle(method, pattern, mediaType string, handle func(w http.ResponseWriter, r *http.Request, p params)) {
+	rr.routes = append(rr.routes, route{
+		method:    method,
+		pattern:   pattern,
+		segments:  strings.Split(strings.TrimPrefix(pattern, "/"), "/"),
+		mediaType: mediaType,
+		handle:    handle,
+	})
+}
+
+// ServeHTTP serves a request and reports how it went to the observer.
+func (rr *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	recorder := recordResponse(w)
+	pattern := rr.serve(recorder, r)
+	if rr.observe != nil {
+		rr.observe(rr.knownMethod(r.Method), pattern, recorder.statusCode(), time.Since(start))
+	}
+}
+
+// knownMethod returns method if some route answers it, otherwise "other".
+func (rr *router) knownMethod(method string) string {
+	for _, rt := range rr.routes {
+		if rt.method == method || (rt.method == http.MethodGet && method == http.MethodHead) {
+			return method
+		}
+	}
+	return "other"
+}
+
+// serve finds the route for a request and checks its method and media type before calling it.
+// It returns the pattern that matched the path, or empty when none did.
+func (rr *router) serve(w *responseRecorder, r *http.Request) string {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	// Find the most specific pattern matching the path
+	pattern, best := "", -1
+	for _, rt := range rr.routes {
+		if _, ok := rt.match(segments); ok && rt.literals() > best {
+			pattern, best = rt.pattern, rt.literals()
+		}
+	}
+	if best < 0 {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "No endpoint at "+r.URL.Path)
+		return ""
+	}
+
+	var allowed []string
+	for _, rt := range rr.routes {
+		if rt.pattern != pattern {
+			continue
+		}
+		if rt.method != r.Method && !(rt.method == http.MethodGet && r.Method == http.MethodHead) {
+			allowed = append(allowed, rt.method)
+			if rt.method == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+			}
+			continue
+		}
+
+		if rt.mediaType != "" {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != rt.mediaType {
+				WriteProblem(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type must be "+rt.mediaType)
+				return pattern
+			}
+			if rr.maxBodyBytes > 0 {
+				// The server's own writer is needed to close the connection after an oversized body
+				r.Body = http.MaxBytesReader(w.ResponseWriter, r.Body, rr.maxBodyBytes)
+			}
+		}
+		p, _ := rt.match(segments)
+		rt.handle(w, r, p)
+		return pattern
+	}
+
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	WriteProblem(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	return pattern
+}
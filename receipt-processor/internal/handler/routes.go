@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// jsonBody is the media type of every request body the service accepts.
+const jsonBody = "application/json"
+
+// Routes returns an http.Handler serving every endpoint of the service.
+// This is the single place routes are registered.
+func (h *Handler) Routes() http.Handler {
+	rr := &router{maxBodyBytes: h.maxBodyBytes, observe: h.metrics.recordRequest}
+
+	// Receipts
+	rr.handle(http.MethodPost, "/receipts/process", jsonBody, func(w http.ResponseWriter, r *http.Request, _ params) {
+		h.ProcessReceipt(w, r)
+	})
+	rr.handle(http.MethodPost, "/receipts/score", jsonBody, func(w http.ResponseWriter, r *http.Request, _ params) {
+		h.ScoreReceipt(w, r)
+	})
+	rr.handle(http.MethodGet, "/receipts", "", func(w http.ResponseWriter, r *http.Request, _ params) {
+		h.ListReceipts(w, r)
+	})
+	rr.handle(http.MethodGet, "/receipts/{id}", "", func(w http.ResponseWriter, r *http.Request, p params) {
+		h.GetReceipt(w, r, p["id"])
+	})
+	rr.handle(http.MethodGet, "/receipts/{id}/points", "", func(w http.ResponseWriter, r *http.Request, p params) {
+		h.GetPoints(w, r, p["id"])
+	})
+	rr.handle(http.MethodGet, "/receipts/{id}/points/breakdown", "", func(w http.ResponseWriter, r *http.Request, p params) {
+		h.GetPointsBreakdown(w, r, p["id"])
+	})
+
+	// Administration
+	rr.handle(http.MethodPost, "/admin/rescore", jsonBody, h.admin(func(w http.ResponseWriter, r *http.Request, _ params) {
+		h.Rescore(w, r)
+	}))
+
+	// Operations
+	rr.handle(http.MethodGet, "/healthz", "", func(w http.ResponseWriter, r *http.Request, _ params) {
+		h.Healthz(w, r)
+	})
+	rr.handle(http.MethodGet, "/readyz", "", func(w http.ResponseWriter, r *http.Request, _ params) {
+		h.Readyz(w, r)
+	})
+	rr.handle(http.MethodGet, "/version", "", func(w http.ResponseWriter, r *http.Request, _ params) {
+		h.Version(w, r)
+	})
+	rr.handle(http.MethodGet, "/metrics", "", func(w http.ResponseWriter, r *http.Request, _ params) {
+		h.GetMetrics(w, r)
+	})
+
+	return rr
+}
+
+// admin guards an administration route so it only runs for requests that carry the admin token as
+// "Authorization: Bearer <token>". Without a configured token administration is disabled entirely.
+func (h *Handler) admin(handle func(w http.ResponseWriter, r *http.Request, p params)) func(w http.ResponseWriter, r *http.Request, p params) {
+	return func(w http.ResponseWriter, r *http.Request, p params) {
+		if h.adminToken == "" {
+			WriteProblem(w, http.StatusForbidden, CodeAdminDisabled, "Administration is disabled; configure an admin token to enable it")
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			WriteProblem(w, http.StatusUnauthorized, CodeUnauthorized, "A valid admin token is required")
+			return
+		}
+		handle(w, r, p)
+	}
+}
@@ -0,0 +1,128 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// DefaultWindow is how long a key is remembered when no window is configured.
+const DefaultWindow = 24 * time.Hour
+
+// Outcome is the result of beginning a request under an idempotency key.
+type Outcome int
+
+const (
+	// Started means the key is new; the caller must Complete or Abort it.
+	Started Outcome = iota
+	// Replayed means the key already finished with the same body; the original receipt ID is returned.
+	Replayed
+	// Mismatch means the key was already used with a different body.
+	Mismatch
+	// InProgress means another request with the key has not finished yet.
+	InProgress
+)
+
+// entry is the state remembered for one key.
+type entry struct {
+	requestHash string
+	receiptID   string // empty while the request is in progress
+	expires     time.Time
+}
+
+// Hash returns the hash of a request body that keys are compared by, as Restore takes it.
+func Hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Keys remembers idempotency keys and the receipt IDs they produced for a limited window.
+type Keys struct {
+	mu        sync.Mutex
+	window    time.Duration
+	entries   map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewKeys creates an empty key store that forgets keys once the window has passed.
+func NewKeys(window time.Duration) *Keys {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Keys{window: window, entries: make(map[string]*entry), now: time.Now}
+}
+
+// Begin claims a key for a request body. It returns the receipt ID when the outcome is Replayed.
+func (k *Keys) Begin(key string, body []byte) (Outcome, string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	k.sweep(now)
+
+	requestHash := Hash(body)
+	if e, ok := k.entries[key]; ok && now.Before(e.expires) {
+		switch {
+		case e.requestHash != requestHash:
+			return Mismatch, ""
+		case e.receiptID == "":
+			return InProgress, ""
+		default:
+			return Replayed, e.receiptID
+		}
+	}
+
+	k.entries[key] = &entry{requestHash: requestHash, expires: now.Add(k.window)}
+	return Started, ""
+}
+
+// Restore remembers a key that completed at started, such as one read back from durable storage
+// after a restart. Keys whose window has already passed are ignored.
+func (k *Keys) Restore(key, requestHash, receiptID string, started time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	expires := started.Add(k.window)
+	if !k.now().Before(expires) {
+		return
+	}
+	if e, ok := k.entries[key]; ok && !e.expires.Before(expires) {
+		return
+	}
+	k.entries[key] = &entry{requestHash: requestHash, receiptID: receiptID, expires: expires}
+}
+
+// Complete records the receipt ID produced for a key claimed with Begin.
+func (k *Keys) Complete(key, receiptID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if e, ok := k.entries[key]; ok {
+		e.receiptID = receiptID
+	}
+}
+
+// Abort releases a key claimed with Begin when the request failed, so the client can retry it.
+func (k *Keys) Abort(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if e, ok := k.entries[key]; ok && e.receiptID == "" {
+		delete(k.entries, key)
+	}
+}
+
+// sweep drops expired keys at most once a minute. The caller must hold k.mu.
+func (k *Keys) sweep(now time.Time) {
+	if now.Sub(k.lastSweep) < time.Minute {
+		return
+	}
+	k.lastSweep = now
+	for key, e := range k.entries {
+		if !now.Before(e.expires) {
+			delete(k.entries, key)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+)
+
+// Testing function for replaying, rejecting and expiring idempotency keys
+func TestKeys(t *testing.T) {
+	now := time.Date(2023, 9, 18, 12, 0, 0, 0, time.UTC)
+	keys := NewKeys(time.Hour)
+	keys.now = func() time.Time { return now }
+
+	body := []byte(`{"retailer":"Target"}`)
+	if outcome, _ := keys.Begin("k1", body); outcome != Started {
+		t.Fatalf("Expected new key to start, got %v", outcome)
+	}
+	if outcome, _ := keys.Begin("k1", body); outcome != InProgress {
+		t.Errorf("Expected unfinished key to be in progress, got %v", outcome)
+	}
+
+	keys.Complete("k1", "receipt-1")
+	if outcome, id := keys.Begin("k1", body); outcome != Replayed || id != "receipt-1" {
+		t.Errorf("Expected replay of receipt-1, got %v %q", outcome, id)
+	}
+	if outcome, _ := keys.Begin("k1", []byte(`{"retailer":"Walmart"}`)); outcome != Mismatch {
+		t.Errorf("Expected a different body to mismatch, got %v", outcome)
+	}
+
+	// An aborted key can be retried
+	keys.Begin("k2", body)
+	keys.Abort("k2")
+	if outcome, _ := keys.Begin("k2", body); outcome != Started {
+		t.Errorf("Expected aborted key to start again, got %v", outcome)
+	}
+
+	// Once the window passes the key is forgotten
+	now = now.Add(time.Hour)
+	if outcome, _ := keys.Begin("k1", []byte(`{"retailer":"Walmart"}`)); outcome != Started {
+		t.Errorf("Expected expired key to start again, got %v", outcome)
+	}
+}
+
+// Testing function for restoring completed keys from storage
+func TestRestore(t *testing.T) {
+	now := time.Date(2023, 9, 18, 12, 0, 0, 0, time.UTC)
+	keys := NewKeys(time.Hour)
+	keys.now = func() time.Time { return now }
+
+	body := []byte(`{"retailer":"Target"}`)
+	keys.Restore("recent", Hash(body), "receipt-1", now.Add(-30*time.Minute))
+	keys.Restore("expired", Hash(body), "receipt-2", now.Add(-time.Hour))
+
+	if outcome, id := keys.Begin("recent", body); outcome != Replayed || id != "receipt-1" {
+		t.Errorf("Expected replay of receipt-1, got %v %q", outcome, id)
+	}
+	if outcome, _ := keys.Begin("recent", []byte(`{"retailer":"Walmart"}`)); outcome != Mismatch {
+		t.Errorf("Expected a different body to mismatch, got %v", outcome)
+	}
+	if outcome, _ := keys.Begin("expired", body); outcome != Started {
+		t.Errorf("Expected a key restored after its window to start again, got %v", outcome)
+	}
+
+	// The restored key expires a window after it was first used, not after the restart
+	now = now.Add(30 * time.Minute)
+	if outcome, _ := keys.Begin("recent", body); outcome != Started {
+		t.Errorf("Expected restored key to expire with its original window, got %v", outcome)
+	}
+}
@@ -0,0 +1,89 @@
+package metrics_test
+
+import (
+	"bytes"
+	"receipt-processor/internal/metrics"
+	"testing"
+)
+
+// Testing function for writing counters, histograms and gauges in the Prometheus text format
+func TestRegistryWrite(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requests := registry.Counter("requests_total", "Requests served.", "route", "code")
+	errors := registry.Counter("errors_total", "Errors.\nAll of them.")
+	latency := registry.Histogram("latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	registry.GaugeFunc("queue_length", "Queued items.", func() float64 { return 3 })
+
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc("/a", `say "hi"`)
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.1, "/a")
+	latency.Observe(2, "/a")
+
+	var out bytes.Buffer
+	if err := registry.Write(&out); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	expected := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/a",code="200"} 2
+requests_total{route="/a",code="say \"hi\""} 1
+requests_total{route="/b",code="200"} 1
+# HELP errors_total Errors.\nAll of them.
+# TYPE errors_total counter
+errors_total 0
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 2
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 2.15
+latency_seconds_count{route="/a"} 3
+# HELP queue_length Queued items.
+# TYPE queue_length gauge
+queue_length 3
+`
+	if out.String() != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	errors.Inc()
+	out.Reset()
+	registry.Write(&out)
+	if !bytes.Contains(out.Bytes(), []byte("\nerrors_total 1\n")) {
+		t.Errorf("Expected errors_total to be 1, got:\n%s", out.String())
+	}
+}
+
+// Testing function for rejecting misuse of the registry
+func TestRegistryMisuse(t *testing.T) {
+	testCases := []struct {
+		name string
+		use  func(registry *metrics.Registry)
+	}{
+		{"duplicate name", func(registry *metrics.Registry) {
+			registry.Counter("a_total", "A.")
+			registry.Counter("a_total", "A again.")
+		}},
+		{"wrong label count", func(registry *metrics.Registry) {
+			registry.Counter("a_total", "A.", "code").Inc()
+		}},
+		{"decreasing counter", func(registry *metrics.Registry) {
+			registry.Counter("a_total", "A.").Add(-1)
+		}},
+		{"unsorted buckets", func(registry *metrics.Registry) {
+			registry.Histogram("a_seconds", "A.", []float64{1, 0.5})
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic")
+				}
+			}()
+			tc.use(metrics.NewRegistry())
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fingerprint computes a canonical hash of a receipt's content so resubmissions of the same
+// paper receipt can be recognized. Retailer and item descriptions are compared case-insensitively
+// with whitespace collapsed, and item order does not matter.
+func Fingerprint(receipt Receipt) string {
+	items := make([]string, 0, len(receipt.Items))
+	for _, item := range receipt.Items {
+		line := fmt.Sprintf("%s=%d", normalize(item.ShortDescription), item.Price.Cents())
+		// Quantities are only added when given, so receipts without them keep their fingerprints
+		if item.Quantity > 0 || item.UnitPrice != nil {
+			var unitPrice Money
+			if item.UnitPrice != nil {
+				unitPrice = *item.UnitPrice
+			}
+			line += fmt.Sprintf("x%d@%d", item.Units(), unitPrice.Cents())
+		}
+		items = append(items, line)
+	}
+	sort.Strings(items)
+
+	parts := []string{
+		normalize(receipt.Retailer),
+		receipt.PurchaseDate,
+		receipt.PurchaseTime,
+		strings.Join(items, "\n"),
+		fmt.Sprint(receipt.Total.Cents()),
+	}
+	// The time zone is only added when given: the same printed time in another zone is another purchase
+	if receipt.TimeZone != "" {
+		parts = append(parts, "tz="+receipt.TimeZone)
+	}
+	// Itemized lines are likewise only added when present
+	if receipt.HasLines() {
+		subtotal, _ := receipt.Amount(AmountSubtotal)
+		tip, _ := receipt.Amount(AmountTip)
+		parts = append(parts, fmt.Sprint(subtotal.Cents()), canonicalLines(receipt.Taxes), canonicalLines(receipt.Discounts), fmt.Sprint(tip.Cents()))
+	}
+	canonical := strings.Join(parts, "\x00")
+
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalLines formats tax or discount lines independently of their order.
+func canonicalLines(lines []Line) string {
+	canonical := make([]string, 0, len(lines))
+	for _, line := range lines {
+		canonical = append(canonical, fmt.Sprintf("%s=%d", normalize(line.Description), line.Amount.Cents()))
+	}
+	sort.Strings(canonical)
+	return strings.Join(canonical, "\n")
+}
+
+// normalize lowercases a string and collapses runs of whitespace into single spaces.
+func normalize(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
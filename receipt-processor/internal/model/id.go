@@ -0,0 +1,95 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IDGenerator produces new receipt IDs.
+type IDGenerator interface {
+	NewID() string
+}
+
+// NewIDGenerator returns the generator for a kind of ID: "uuid" or "ulid".
+func NewIDGenerator(kind string) (IDGenerator, error) {
+	switch kind {
+	case "uuid":
+		return UUIDGenerator{}, nil
+	case "ulid":
+		return &ULIDGenerator{}, nil
+	}
+	return nil, fmt.Errorf("unknown ID kind %q: must be uuid or ulid", kind)
+}
+
+// UUIDGenerator produces random RFC 4122 version 4 UUIDs such as "7fb1377b-b223-49d9-a31a-5a02701dd310".
+// They reveal nothing about when a receipt was stored.
+type UUIDGenerator struct{}
+
+// NewID returns a new random UUID.
+func (UUIDGenerator) NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("read random bytes: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator produces ULIDs: 26 character IDs made of a millisecond timestamp and 80 random bits
+// that sort in creation order. IDs made within the same millisecond increment the random part so
+// they stay ordered.
+type ULIDGenerator struct {
+	mu         sync.Mutex
+	lastMillis uint64
+	lastRandom [10]byte
+	now        func() time.Time
+}
+
+// NewID returns a new ULID that sorts after every ULID previously returned by this generator.
+func (g *ULIDGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now
+	if g.now != nil {
+		now = g.now
+	}
+	millis := uint64(now().UnixMilli())
+
+	if millis <= g.lastMillis {
+		// Same (or an earlier, if the clock stepped back) millisecond: increment the random part
+		millis = g.lastMillis
+		for i := len(g.lastRandom) - 1; i >= 0; i-- {
+			g.lastRandom[i]++
+			if g.lastRandom[i] != 0 {
+				break
+			}
+		}
+	} else if _, err := rand.Read(g.lastRandom[:]); err != nil {
+		panic(fmt.Sprintf("read random bytes: %v", err))
+	}
+	g.lastMillis = millis
+
+	// 48-bit timestamp followed by 80 random bits, 130 bits encoded 5 at a time
+	var b [16]byte
+	binary.BigEndian.PutUint16(b[0:2], uint16(millis>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(millis))
+	copy(b[6:], g.lastRandom[:])
+
+	var id [26]byte
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	for i := 25; i >= 0; i-- {
+		id[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id[:])
+}
@@ -1,115 +1,117 @@
 package model
 
-import (
-	"fmt"
-	"math"
-	"math/rand"
-	"regexp"
-	"strconv"
-	"strings"
-	"sync"
-	"time"
-)
-
 type Receipt struct {
 	Retailer     string `json:"retailer"`
 	PurchaseDate string `json:"purchaseDate"`
 	PurchaseTime string `json:"purchaseTime"`
+	TimeZone     string `json:"timeZone,omitempty"` // IANA zone of the purchase date and time; UTC when empty
 	Items        []Item `json:"items"`
-	Total        string `json:"total"`
+	Subtotal     *Money `json:"subtotal,omitempty"`
+	Taxes        []Line `json:"taxes,omitempty"`
+	Discounts    []Line `json:"discounts,omitempty"`
+	Tip          *Money `json:"tip,omitempty"`
+	Total        Money  `json:"total"`
 }
 
+// Item is one line of a receipt. Price is the price of the whole line; a line such as
+// "3 x Gatorade @ 2.25" also gives the Quantity and UnitPrice.
 type Item struct {
 	ShortDescription string `json:"shortDescription"`
-	Price            string `json:"price"`
+	Price            Money  `json:"price"`
+	Quantity         int    `json:"quantity,omitempty"`
+	UnitPrice        *Money `json:"unitPrice,omitempty"`
 }
 
-// In-memory storage
-var receipts = make(map[string]Receipt)
-var receiptPoints = make(map[string]int)
-var mu sync.Mutex // Mutex for locking access to the maps
-
-// StoreReceipt saves a receipt and returns a generated ID
-func StoreReceipt(receipt Receipt) string {
-	mu.Lock()
-	defer mu.Unlock()
-
-	// Combine current time and a random number for the ID to avoid collisions
-	id := fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Intn(1000000))
-
-	receipts[id] = receipt
-	points := TallyPoints(receipt)
-	receiptPoints[id] = points
-	return id
+// Units returns the number of units on the line, which is one unless a quantity is given.
+func (i Item) Units() int {
+	if i.Quantity > 0 {
+		return i.Quantity
+	}
+	return 1
 }
 
-func TallyPoints(receipt Receipt) int {
+// Line is a tax or discount line on a receipt. Amounts are positive; discounts are subtracted from the total.
+type Line struct {
+	Description string `json:"description,omitempty"`
+	Amount      Money  `json:"amount"`
+}
 
-	var points int = 0
+// Names of the receipt amounts that scoring rules can reference
+const (
+	AmountTotal    = "total"
+	AmountSubtotal = "subtotal" // the items before discounts and tax
+	AmountPreTax   = "preTax"   // the subtotal less discounts
+	AmountTax      = "tax"
+	AmountDiscount = "discount"
+	AmountTip      = "tip"
+)
 
-	// Add points for all alphanumeric characters
-	is_alphanumeric := regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString
-	for _, char := range receipt.Retailer {
-		if is_alphanumeric(string(char)) {
-			points++
-		}
+// IsAmountName reports whether name is one of the receipt amounts that Amount understands.
+func IsAmountName(name string) bool {
+	switch name {
+	case AmountTotal, AmountSubtotal, AmountPreTax, AmountTax, AmountDiscount, AmountTip:
+		return true
 	}
+	return false
+}
 
-	// Add points for multiples of 0.25 and for no cent dollar amounts
-	totalFloat, err := strconv.ParseFloat(receipt.Total, 64)
-	if err == nil {
-		totalCents := int(totalFloat * 100)
-		if totalCents%100 == 0 {
-			points += 50
-		}
-
-		if totalCents%25 == 0 {
-			points += 25
-		}
-
+// ItemsTotal returns the sum of the item prices.
+func (r Receipt) ItemsTotal() Money {
+	var sum Money
+	for _, item := range r.Items {
+		sum += item.Price
 	}
+	return sum
+}
 
-	var itemCount int = 0
-	for _, item := range receipt.Items {
-
-		// Points for itemCounts that are at 2
-		itemCount++
-		if itemCount == 2 {
-			itemCount = 0
-			points += 5
-		}
+// HasLines reports whether the receipt itemizes a subtotal, tax, discounts or a tip.
+func (r Receipt) HasLines() bool {
+	return r.Subtotal != nil || len(r.Taxes) > 0 || len(r.Discounts) > 0 || r.Tip != nil
+}
 
-		// Points for item descriptions being multiples of 3
-		if len(strings.TrimSpace(item.ShortDescription))%3 == 0 {
-			price, err := strconv.ParseFloat(item.Price, 64)
-			if err == nil {
-				additionalPoints := math.Ceil(price * 0.2)
-				points += int(additionalPoints)
-			}
-		}
+// ComputedTotal returns the total implied by the receipt's lines: the items, less discounts, plus tax and tip.
+// Without any itemized lines it is just the sum of the items.
+func (r Receipt) ComputedTotal() Money {
+	total := r.ItemsTotal() - sumLines(r.Discounts) + sumLines(r.Taxes)
+	if r.Tip != nil {
+		total += *r.Tip
 	}
+	return total
+}
 
-	// Points if the day in the purchase date is odd
-	t, _ := time.Parse("2006-01-02", receipt.PurchaseDate)
-	if t.Day()%2 == 1 {
-		points += 6
+// Amount returns one of the named receipt amounts, and false when the receipt does not have it.
+// The subtotal falls back to the sum of the items when the receipt does not state one.
+func (r Receipt) Amount(name string) (Money, bool) {
+	subtotal := r.ItemsTotal()
+	if r.Subtotal != nil {
+		subtotal = *r.Subtotal
 	}
 
-	// Points if the time of purchase is after 2:00pm and before 4:00pm
-	t, _ = time.Parse("15:04", receipt.PurchaseTime)
-	minutesPastMidnight := t.Hour()*60 + t.Minute() // t.hour only gives hours, needs minutes too
-	if minutesPastMidnight > (14*60) && minutesPastMidnight < (16*60) {
-		points += 10
+	switch name {
+	case AmountTotal:
+		return r.Total, true
+	case AmountSubtotal:
+		return subtotal, true
+	case AmountPreTax:
+		return subtotal - sumLines(r.Discounts), true
+	case AmountTax:
+		return sumLines(r.Taxes), len(r.Taxes) > 0
+	case AmountDiscount:
+		return sumLines(r.Discounts), len(r.Discounts) > 0
+	case AmountTip:
+		if r.Tip == nil {
+			return 0, false
+		}
+		return *r.Tip, true
 	}
-
-	return points
+	return 0, false
 }
 
-// GetPoints retrieves points for a receipt ID
-func GetPoints(id string) (int, bool) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	points, ok := receiptPoints[id]
-	return points, ok
+// sumLines adds up the amounts of tax or discount lines.
+func sumLines(lines []Line) Money {
+	var sum Money
+	for _, line := range lines {
+		sum += line.Amount
+	}
+	return sum
 }
@@ -3,15 +3,37 @@ package model_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"receipt-processor/internal/handler"
 	"receipt-processor/internal/model"
+	"receipt-processor/internal/rules"
+	"receipt-processor/internal/store"
+	"receipt-processor/internal/validate"
+	"regexp"
+	"strings"
 	"testing"
 )
 
+// newHandler creates a handler backed by the given store that scores with the default rule set
+func newHandler(t *testing.T, receiptStore model.ReceiptStore) *handler.Handler {
+	return newHandlerWithOptions(t, receiptStore, handler.Options{})
+}
+
+// newHandlerWithOptions is like newHandler with non-default handler options
+func newHandlerWithOptions(t *testing.T, receiptStore model.ReceiptStore, options handler.Options) *handler.Handler {
+	registry, err := rules.NewRegistry(rules.Default())
+	if err != nil {
+		t.Fatalf("Failed to create rule registry: %v", err)
+	}
+	return handler.New(receiptStore, registry, options)
+}
+
 // Testing function for Tallying points
 func TestTallyPoints(t *testing.T) {
+	money := model.MustParseMoney
 	testCases := []struct {
 		retailer       string
 		purchaseDate   string
@@ -21,64 +43,69 @@ func TestTallyPoints(t *testing.T) {
 		expectedPoints int
 	}{
 		// tests for alphanumerics
-		{"ABC", "2023-09-19", "15:00", "10.00", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 94},
-		{"123", "2023-09-19", "15:00", "10.00", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 94},
-		{"]'..,'.'/][][.].,", "2023-09-19", "15:00", "10.00", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 91},
-		{"123,ABC,real,=-';][;]", "2023-09-19", "15:00", "10.00", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 101},
-		{"REAL,123,talk,.", "2023-09-18", "12:00", "0.01", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 11},
+		{"ABC", "2023-09-19", "15:00", "10.00", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 94},
+		{"123", "2023-09-19", "15:00", "10.00", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 94},
+		{"]'..,'.'/][][.].,", "2023-09-19", "15:00", "10.00", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 91},
+		{"123,ABC,real,=-';][;]", "2023-09-19", "15:00", "10.00", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 101},
+		{"REAL,123,talk,.", "2023-09-18", "12:00", "0.01", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 11},
 		// tests for time
-		{"XYZ", "2023-09-19", "13:59", "10.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 34},
-		{"XYZ", "2023-09-19", "14:00", "10.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 34},
-		{"XYZ", "2023-09-19", "14:01", "10.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 44},
-		{"XYZ", "2023-09-19", "15:00", "10.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 44},
-		{"XYZ", "2023-09-19", "16:01", "10.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 34},
-		{"XYZ", "2023-09-19", "16:00", "10.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 34},
-		{"XYZ", "2023-09-19", "15:59", "10.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 44},
+		{"XYZ", "2023-09-19", "13:59", "10.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 34},
+		{"XYZ", "2023-09-19", "14:00", "10.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 34},
+		{"XYZ", "2023-09-19", "14:01", "10.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 44},
+		{"XYZ", "2023-09-19", "15:00", "10.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 44},
+		{"XYZ", "2023-09-19", "16:01", "10.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 34},
+		{"XYZ", "2023-09-19", "16:00", "10.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 34},
+		{"XYZ", "2023-09-19", "15:59", "10.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 44},
 		// tests on multiples of 0.25 and round dollar values
-		{"XYZ", "2023-09-19", "15:59", "0.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 44},
-		{"XYZ", "2023-09-19", "15:59", "10.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 44},
-		{"XYZ", "2023-09-19", "15:59", "10.26", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 19},
-		{"XYZ", "2023-09-19", "15:59", "0.33", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 19},
-		{"XYZ", "2023-09-19", "15:59", "1.00", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 94},
-		{"XYZ", "2023-09-19", "15:59", "10.00", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 94},
-		{"XYZ", "2023-09-19", "15:59", "1", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 94},
+		{"XYZ", "2023-09-19", "15:59", "0.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 44},
+		{"XYZ", "2023-09-19", "15:59", "10.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 44},
+		{"XYZ", "2023-09-19", "15:59", "10.26", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 19},
+		{"XYZ", "2023-09-19", "15:59", "0.33", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 19},
+		{"XYZ", "2023-09-19", "15:59", "1.00", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 94},
+		{"XYZ", "2023-09-19", "15:59", "10.00", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 94},
+		{"XYZ", "2023-09-19", "15:59", "1", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 94},
 		// tests on purchase date
-		{"XYZ", "2023-09-19", "15:59", "0.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 44},
-		{"XYZ", "2023-09-18", "15:59", "0.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 38},
-		{"XYZ", "2023-09-30", "15:59", "0.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 38},
-		{"XYZ", "2023-09-01", "15:59", "0.25", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 44},
+		{"XYZ", "2023-09-19", "15:59", "0.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 44},
+		{"XYZ", "2023-09-18", "15:59", "0.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 38},
+		{"XYZ", "2023-09-30", "15:59", "0.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 38},
+		{"XYZ", "2023-09-01", "15:59", "0.25", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 44},
 		// tests on item count
-		{"[]", "2023-09-18", "12:00", "0.01", []model.Item{{Price: "0.01", ShortDescription: "abccd"}}, 0},
-		{"[]", "2023-09-18", "12:00", "0.01", []model.Item{{Price: "0.01", ShortDescription: "abccd"}, {Price: "0.01", ShortDescription: "abccd"}}, 5},
-		{"[]", "2023-09-18", "12:00", "0.01", []model.Item{{Price: "0.01", ShortDescription: "abccd"}, {Price: "0.01", ShortDescription: "abccd"}, {Price: "0.01", ShortDescription: "abccd"}}, 5},
-		{"[]", "2023-09-18", "12:00", "0.01", []model.Item{{Price: "0.01", ShortDescription: "abccd"}, {Price: "0.01", ShortDescription: "abccd"}, {Price: "0.01", ShortDescription: "abccd"}, {Price: "0.01", ShortDescription: "abccd"}}, 10},
+		{"[]", "2023-09-18", "12:00", "0.01", []model.Item{{Price: money("0.01"), ShortDescription: "abccd"}}, 0},
+		{"[]", "2023-09-18", "12:00", "0.01", []model.Item{{Price: money("0.01"), ShortDescription: "abccd"}, {Price: money("0.01"), ShortDescription: "abccd"}}, 5},
+		{"[]", "2023-09-18", "12:00", "0.01", []model.Item{{Price: money("0.01"), ShortDescription: "abccd"}, {Price: money("0.01"), ShortDescription: "abccd"}, {Price: money("0.01"), ShortDescription: "abccd"}}, 5},
+		{"[]", "2023-09-18", "12:00", "0.01", []model.Item{{Price: money("0.01"), ShortDescription: "abccd"}, {Price: money("0.01"), ShortDescription: "abccd"}, {Price: money("0.01"), ShortDescription: "abccd"}, {Price: money("0.01"), ShortDescription: "abccd"}}, 10},
 
 		//tests on item descriptions that are multiples of 3
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "1.20", ShortDescription: "abccd"}}, 0},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "1.20", ShortDescription: "abccd"}, {Price: "1.20", ShortDescription: "abccd"}}, 5},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "1.20", ShortDescription: "abccd"}, {Price: "1.20", ShortDescription: "abccd"}, {Price: "1.20", ShortDescription: "abccd"}, {Price: "1.20", ShortDescription: "abccd"}}, 10},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "1.20", ShortDescription: "abc"}, {Price: "1.20", ShortDescription: "abc"}}, 7},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "1.20", ShortDescription: "abc"}, {Price: "1.20", ShortDescription: "abc"}, {Price: "1.20", ShortDescription: "abc"}, {Price: "1.20", ShortDescription: "abc"}}, 14},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}}, 0},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}, {Price: money("1.20"), ShortDescription: "abccd"}}, 5},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("1.20"), ShortDescription: "abccd"}, {Price: money("1.20"), ShortDescription: "abccd"}, {Price: money("1.20"), ShortDescription: "abccd"}, {Price: money("1.20"), ShortDescription: "abccd"}}, 10},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("1.20"), ShortDescription: "abc"}, {Price: money("1.20"), ShortDescription: "abc"}}, 7},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("1.20"), ShortDescription: "abc"}, {Price: money("1.20"), ShortDescription: "abc"}, {Price: money("1.20"), ShortDescription: "abc"}, {Price: money("1.20"), ShortDescription: "abc"}}, 14},
 		// trimmed should mean removing trailing and leading whitespaces, meaning whitespaces in the middle should count
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "1.00", ShortDescription: "abc def"}}, 0},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "1.00", ShortDescription: " abcdef "}}, 1},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "5.00", ShortDescription: "abcdefghi"}}, 1},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "4.99", ShortDescription: "aaa    aa"}}, 1},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "0", ShortDescription: "avc"}}, 0},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "10", ShortDescription: "abc"}, {Price: "100", ShortDescription: "abc"}, {Price: "0.01", ShortDescription: "abc"}, {Price: "1.20", ShortDescription: "abc"}}, 34},
-		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: "100", ShortDescription: "a"}, {Price: "100", ShortDescription: "abc"}, {Price: "1.20", ShortDescription: "abcdef"}, {Price: "1.20", ShortDescription: "abcdefg"}}, 31},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("1.00"), ShortDescription: "abc def"}}, 0},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("1.00"), ShortDescription: " abcdef "}}, 1},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("5.00"), ShortDescription: "abcdefghi"}}, 1},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("4.99"), ShortDescription: "aaa    aa"}}, 1},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("0"), ShortDescription: "avc"}}, 0},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("10"), ShortDescription: "abc"}, {Price: money("100"), ShortDescription: "abc"}, {Price: money("0.01"), ShortDescription: "abc"}, {Price: money("1.20"), ShortDescription: "abc"}}, 34},
+		{"]", "2023-09-18", "14:00", "0.01", []model.Item{{Price: money("100"), ShortDescription: "a"}, {Price: money("100"), ShortDescription: "abc"}, {Price: money("1.20"), ShortDescription: "abcdef"}, {Price: money("1.20"), ShortDescription: "abcdefg"}}, 31},
 	}
 
+	receiptStore := store.NewMemoryStore()
+	ruleSet := rules.Default()
 	for _, tc := range testCases {
 		receipt := model.Receipt{
 			Retailer:     tc.retailer,
 			PurchaseDate: tc.purchaseDate,
 			PurchaseTime: tc.purchaseTime,
-			Total:        tc.total,
+			Total:        money(tc.total),
 			Items:        tc.items,
 		}
-		id := model.StoreReceipt(receipt)
-		points, ok := model.GetPoints(id)
+		id, err := model.StoreReceipt(receiptStore, model.UUIDGenerator{}, model.Record{Receipt: receipt, Points: ruleSet.Tally(receipt)})
+		if err != nil {
+			t.Fatalf("Failed to store receipt: %v", err)
+		}
+		points, ok := receiptStore.GetPoints(id)
 		if !ok {
 			t.Errorf("No points stored for receipt ID %s", id)
 			continue
@@ -97,13 +124,15 @@ func TestProcessReceipt_Failures(t *testing.T) {
 		input      model.Receipt
 		inputRaw   []byte
 		httpStatus int
-		errorMsg   string
+		errorCode  string
+		fields     []string // "field:code" for every failing field, in order
 	}{
 		{
 			name:       "Missing or invalid fields",
 			input:      model.Receipt{},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Missing or invalid fields\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"retailer:missing_field", "purchaseDate:missing_field", "purchaseTime:missing_field", "items:missing_field", "total:zero_price"},
 		},
 		{
 			name: "Missing or invalid fields",
@@ -111,11 +140,12 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				Retailer:     "", //empty
 				PurchaseDate: "2023-13-01",
 				PurchaseTime: "15:00",
-				Items:        []model.Item{{"item1", "2.50"}},
-				Total:        "5.00",
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.MustParseMoney("2.50")}},
+				Total:        model.MustParseMoney("5.00"),
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Missing or invalid fields\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"retailer:missing_field", "purchaseDate:invalid_date_format"},
 		},
 		{
 			name: "Missing or invalid fields",
@@ -123,11 +153,12 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				Retailer:     "dfsaf",
 				PurchaseDate: "", // empty
 				PurchaseTime: "15:00",
-				Items:        []model.Item{{"item1", "2.50"}},
-				Total:        "5.00",
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.MustParseMoney("2.50")}},
+				Total:        model.MustParseMoney("5.00"),
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Missing or invalid fields\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"purchaseDate:missing_field"},
 		},
 		{
 			name: "Missing or invalid fields",
@@ -135,11 +166,12 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				Retailer:     "dfsaf",
 				PurchaseDate: "2023-13-01",
 				PurchaseTime: "", // empty
-				Items:        []model.Item{{"item1", "2.50"}},
-				Total:        "5.00",
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.MustParseMoney("2.50")}},
+				Total:        model.MustParseMoney("5.00"),
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Missing or invalid fields\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"purchaseDate:invalid_date_format", "purchaseTime:missing_field"},
 		},
 		{
 			name: "Missing or invalid fields",
@@ -148,28 +180,32 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				PurchaseDate: "2023-13-01",
 				PurchaseTime: "15:00",
 				Items:        []model.Item{}, // empty
-				Total:        "5.00",
+				Total:        model.MustParseMoney("5.00"),
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Missing or invalid fields\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"purchaseDate:invalid_date_format", "items:missing_field"},
 		},
 		{
-			name: "Missing or invalid fields",
-			input: model.Receipt{
-				Retailer:     "dfsaf",
-				PurchaseDate: "2023-13-01",
-				PurchaseTime: "15:00",
-				Items:        []model.Item{{"item1", "2.50"}},
-				Total:        "", // empty
-			},
+			name:       "Empty total",
+			inputRaw:   []byte(`{"retailer":"dfsaf","purchaseDate":"2023-13-01","purchaseTime":"15:00","items":[{"shortDescription":"item1","price":"2.50"}],"total":""}`),
+			httpStatus: http.StatusBadRequest,
+			errorCode:  "invalid_receipt",
+			fields:     []string{"purchaseDate:invalid_date_format", "total:invalid_price_format"},
+		},
+		{
+			name:       "Every invalid field is reported",
+			inputRaw:   []byte(`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"a","price":"1.00"},{"shortDescription":"b","price":"abc"},{"shortDescription":"c","price":"0.00"},{"shortDescription":"d"}]}`),
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Missing or invalid fields\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"items[1].price:invalid_price_format", "items[2].price:zero_price", "items[3].price:missing_field", "total:missing_field"},
 		},
 		{
 			name:       "Invalid request payload",
 			inputRaw:   []byte(`{"invalid json`),
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Invalid request payload\n",
+			errorCode:  "invalid_json",
+			fields:     nil,
 		},
 		{
 			name: "Invalid date format",
@@ -177,23 +213,25 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				Retailer:     "Walmart",
 				PurchaseDate: "2023-13-01", // invalid date
 				PurchaseTime: "15:00",
-				Items:        []model.Item{{"item1", "2.50"}},
-				Total:        "5.00",
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.MustParseMoney("2.50")}},
+				Total:        model.MustParseMoney("5.00"),
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Invalid date format\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"purchaseDate:invalid_date_format"},
 		},
 		{
 			name: "Date cannot be in the future",
 			input: model.Receipt{
 				Retailer:     "Walmart",
-				PurchaseDate: "2023-11-10", // Future date
+				PurchaseDate: "2999-11-10", // Future date
 				PurchaseTime: "15:00",
-				Items:        []model.Item{{"item1", "2.50"}},
-				Total:        "5.00",
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.MustParseMoney("2.50")}},
+				Total:        model.MustParseMoney("5.00"),
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Date cannot be in the future\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"purchaseDate:future_date"},
 		},
 
 		{
@@ -202,11 +240,12 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				Retailer:     "Walmart",
 				PurchaseDate: "2023-08-10",
 				PurchaseTime: "25:00", // invalid time
-				Items:        []model.Item{{"item1", "2.50"}},
-				Total:        "5.00",
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.MustParseMoney("2.50")}},
+				Total:        model.MustParseMoney("5.00"),
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Invalid time format\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"purchaseTime:invalid_time_format"},
 		},
 		{
 			name: "Invalid Item Price negative",
@@ -214,11 +253,12 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				Retailer:     "Walmart",
 				PurchaseDate: "2023-08-10",
 				PurchaseTime: "14:00",
-				Items:        []model.Item{{"item1", "-2.50"}}, // negative item price
-				Total:        "10.00",
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.Money(-250)}}, // negative item price
+				Total:        model.MustParseMoney("10.00"),
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Invalid Price Format\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"items[0].price:invalid_price_format"},
 		},
 		{
 			name: "Invalid Item Price Zero",
@@ -226,11 +266,12 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				Retailer:     "Walmart",
 				PurchaseDate: "2023-08-10",
 				PurchaseTime: "14:00",
-				Items:        []model.Item{{"item1", "0"}}, // 0 Item price
-				Total:        "10.00",
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.MustParseMoney("0")}}, // 0 Item price
+				Total:        model.MustParseMoney("10.00"),
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Zero Price error\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"items[0].price:zero_price"},
 		},
 		{
 			name: "Invalid Total Price",
@@ -238,11 +279,12 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				Retailer:     "Walmart",
 				PurchaseDate: "2023-08-10",
 				PurchaseTime: "14:00",
-				Items:        []model.Item{{"item1", "10.00"}},
-				Total:        "0", // zero price
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.MustParseMoney("10.00")}},
+				Total:        model.MustParseMoney("0"), // zero price
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Zero Price error\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"total:zero_price"},
 		},
 		{
 			name: "Invalid Total Price",
@@ -250,11 +292,26 @@ func TestProcessReceipt_Failures(t *testing.T) {
 				Retailer:     "Walmart",
 				PurchaseDate: "2023-08-10",
 				PurchaseTime: "14:00",
-				Items:        []model.Item{{"item1", "10.00"}},
-				Total:        "-10.00", // negative price
+				Items:        []model.Item{{ShortDescription: "item1", Price: model.MustParseMoney("10.00")}},
+				Total:        model.Money(-1000), // negative price
 			},
 			httpStatus: http.StatusBadRequest,
-			errorMsg:   "Invalid Price Format\n",
+			errorCode:  "invalid_receipt",
+			fields:     []string{"total:invalid_price_format"},
+		},
+		{
+			name:       "Itemized lines that do not add up",
+			inputRaw:   []byte(`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi","price":"1.25"}],"subtotal":"1.25","taxes":[{"description":"Sales tax","amount":"0.10"}],"discounts":[{"amount":"abc"}],"tip":"-1.00","total":"1.25"}`),
+			httpStatus: http.StatusBadRequest,
+			errorCode:  "invalid_receipt",
+			fields:     []string{"discounts[0].amount:invalid_price_format", "tip:invalid_price_format"},
+		},
+		{
+			name:       "Itemized total mismatch",
+			inputRaw:   []byte(`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi","price":"1.25"}],"taxes":[{"description":"Sales tax","amount":"0.10"}],"total":"1.25"}`),
+			httpStatus: http.StatusBadRequest,
+			errorCode:  "invalid_receipt",
+			fields:     []string{"total:total_mismatch"},
 		},
 	}
 
@@ -272,18 +329,30 @@ func TestProcessReceipt_Failures(t *testing.T) {
 			req.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 
-			handler.ProcessReceipt(w, req)
+			newHandler(t, store.NewMemoryStore()).ProcessReceipt(w, req)
 
 			// Verify the HTTP status code
 			if w.Code != tc.httpStatus {
 				t.Errorf("Expected HTTP status code %d, got %d", tc.httpStatus, w.Code)
 			}
 
-			// Verify the error message
-			if tc.errorMsg != "" {
-				if w.Body.String() != tc.errorMsg {
-					t.Errorf("Expected error message '%s', got '%s'", tc.errorMsg, w.Body.String())
-				}
+			// Verify the problem response
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/problem+json" {
+				t.Errorf("Expected Content-Type application/problem+json, got %s", contentType)
+			}
+			var problem handler.Problem
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+				t.Fatalf("Failed to decode problem response: %v", err)
+			}
+			if problem.Code != tc.errorCode || problem.Status != tc.httpStatus {
+				t.Errorf("Expected error code %s with status %d, got %s with status %d", tc.errorCode, tc.httpStatus, problem.Code, problem.Status)
+			}
+			var fields []string
+			for _, fieldError := range problem.Errors {
+				fields = append(fields, fieldError.Field+":"+fieldError.Code)
+			}
+			if strings.Join(fields, ",") != strings.Join(tc.fields, ",") {
+				t.Errorf("Expected failing fields %v, got %v", tc.fields, fields)
 			}
 		})
 	}
@@ -295,19 +364,870 @@ func TestGetPointsFailure_SingleCase(t *testing.T) {
 	req := httptest.NewRequest("GET", "/getpoints/some-fake-id", nil)
 	w := httptest.NewRecorder()
 
-	// Expected HTTP status and error message
+	// Expected HTTP status and error code
 	expectedHttpStatus := http.StatusNotFound
-	expectedErrorMsg := "No receipt found for that id\n"
+	expectedErrorCode := handler.CodeReceiptNotFound
 
-	handler.GetPoints(w, req, "some-fake-id")
+	newHandler(t, store.NewMemoryStore()).GetPoints(w, req, "some-fake-id")
 
 	// Verify the HTTP status code
 	if w.Code != expectedHttpStatus {
 		t.Errorf("Expected HTTP status code %d, got %d", expectedHttpStatus, w.Code)
 	}
 
-	// Verify the error message
-	if w.Body.String() != expectedErrorMsg {
-		t.Errorf("Expected error message '%s', got '%s'", expectedErrorMsg, w.Body.String())
+	// Verify the error code
+	var problem handler.Problem
+	json.NewDecoder(w.Body).Decode(&problem)
+	if problem.Code != expectedErrorCode {
+		t.Errorf("Expected error code '%s', got '%s'", expectedErrorCode, problem.Code)
+	}
+}
+
+// Testing function for parsing and formatting exact money amounts
+func TestParseMoney(t *testing.T) {
+	testCases := []struct {
+		input    string
+		cents    int64
+		expected string
+		valid    bool
+	}{
+		{"0.29", 29, "0.29", true},
+		{"10", 1000, "10.00", true},
+		{"1234.50", 123450, "1234.50", true},
+		{"0", 0, "0.00", true},
+		{"", 0, "", false},
+		{"-2.50", 0, "", false},
+		{"1.5", 0, "", false},
+		{"1.234", 0, "", false},
+		{"abc", 0, "", false},
+		{"99999999999999999999", 0, "", false},
+	}
+
+	for _, tc := range testCases {
+		m, err := model.ParseMoney(tc.input)
+		if !tc.valid {
+			if err == nil {
+				t.Errorf("ParseMoney(%q): expected an error, got %v", tc.input, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q): unexpected error %v", tc.input, err)
+			continue
+		}
+		if m.Cents() != tc.cents || m.String() != tc.expected {
+			t.Errorf("ParseMoney(%q): expected %d cents (%s), got %d cents (%s)", tc.input, tc.cents, tc.expected, m.Cents(), m)
+		}
+	}
+}
+
+// test function for the per-rule points breakdown endpoint
+func TestGetPointsBreakdown(t *testing.T) {
+	receiptStore := store.NewMemoryStore()
+	ruleSet := rules.Default()
+	h := newHandler(t, receiptStore)
+
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []model.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: model.MustParseMoney("6.49")},
+			{ShortDescription: "Emils Cheese Pizza", Price: model.MustParseMoney("12.25")},
+			{ShortDescription: "Knorr Creamy Chicken", Price: model.MustParseMoney("1.26")},
+			{ShortDescription: "Doritos Nacho Cheese", Price: model.MustParseMoney("3.35")},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: model.MustParseMoney("12.00")},
+		},
+		Total: model.MustParseMoney("35.35"),
+	}
+	id, err := model.StoreReceipt(receiptStore, model.UUIDGenerator{}, model.Record{Receipt: receipt, Points: ruleSet.Tally(receipt), RuleVersion: ruleSet.Version})
+	if err != nil {
+		t.Fatalf("Failed to store receipt: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/receipts/"+id+"/points/breakdown", nil)
+	w := httptest.NewRecorder()
+	h.GetPointsBreakdown(w, req, id)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected HTTP status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Points      int            `json:"points"`
+		RuleVersion string         `json:"ruleVersion"`
+		Breakdown   []rules.Result `json:"breakdown"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	expected := map[string]int{
+		"retailer_alphanumeric": 6,
+		"round_dollar":          0,
+		"quarter_multiple":      0,
+		"item_pairs":            10,
+		"description_length":    6,
+		"odd_day":               6,
+		"afternoon_window":      0,
+	}
+	if response.Points != 28 {
+		t.Errorf("Expected 28 points, got %d", response.Points)
+	}
+	if response.RuleVersion != ruleSet.Version {
+		t.Errorf("Expected rule version %s, got %s", ruleSet.Version, response.RuleVersion)
+	}
+	if len(response.Breakdown) != len(expected) {
+		t.Fatalf("Expected %d rules in breakdown, got %d", len(expected), len(response.Breakdown))
+	}
+	for _, result := range response.Breakdown {
+		if result.Points != expected[result.Rule] {
+			t.Errorf("Rule %s: expected %d points, got %d (%s)", result.Rule, expected[result.Rule], result.Points, result.Reason)
+		}
+		if result.Reason == "" {
+			t.Errorf("Rule %s has no reason", result.Rule)
+		}
+	}
+
+	// Unknown IDs are reported as not found
+	w = httptest.NewRecorder()
+	h.GetPointsBreakdown(w, httptest.NewRequest("GET", "/receipts/missing/points/breakdown", nil), "missing")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected HTTP status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// test function for the rule set version pinned to stored points
+func TestPointsRuleVersion(t *testing.T) {
+	receiptStore := store.NewMemoryStore()
+	h := newHandler(t, receiptStore)
+
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+	req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ProcessReceipt(w, req)
+
+	var processed map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&processed); err != nil {
+		t.Fatalf("Failed to decode process response: %v", err)
+	}
+	id := processed["id"]
+
+	w = httptest.NewRecorder()
+	h.GetPoints(w, httptest.NewRequest("GET", "/receipts/"+id+"/points", nil), id)
+	var points struct {
+		Points      int    `json:"points"`
+		RuleVersion string `json:"ruleVersion"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&points); err != nil {
+		t.Fatalf("Failed to decode points response: %v", err)
+	}
+	if points.Points != 37 || points.RuleVersion != rules.Default().Version {
+		t.Errorf("Expected 37 points from version %s, got %d from version %s", rules.Default().Version, points.Points, points.RuleVersion)
+	}
+
+	// A receipt scored by a rule set that is no longer loaded cannot be explained
+	receiptStore.Put(model.Record{ID: "old", Receipt: model.Receipt{Retailer: "Target"}, Points: 5, RuleVersion: "retired"})
+	w = httptest.NewRecorder()
+	h.GetPointsBreakdown(w, httptest.NewRequest("GET", "/receipts/old/points/breakdown", nil), "old")
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected HTTP status code %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+// test function for the dry-run scoring endpoint
+func TestScoreReceipt(t *testing.T) {
+	receiptStore := store.NewMemoryStore()
+	h := newHandler(t, receiptStore)
+
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+	req := httptest.NewRequest("POST", "/receipts/score", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ScoreReceipt(w, req)
+
+	var response struct {
+		ID          string         `json:"id"`
+		Points      int            `json:"points"`
+		RuleVersion string         `json:"ruleVersion"`
+		Breakdown   []rules.Result `json:"breakdown"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Points != 37 || response.ID != "" || len(response.Breakdown) == 0 {
+		t.Errorf("Unexpected score response %+v", response)
+	}
+
+	if records, _ := receiptStore.List(); len(records) != 0 {
+		t.Errorf("Expected nothing to be stored, found %d records", len(records))
+	}
+
+	// Scoring runs the same validation as processing
+	req = httptest.NewRequest("POST", "/receipts/score", bytes.NewBufferString(`{"retailer":"Target"}`))
+	w = httptest.NewRecorder()
+	h.ScoreReceipt(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), validate.FieldMissing) {
+		t.Errorf("Expected missing fields error, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// test function for retrieving a full stored receipt
+func TestGetReceipt(t *testing.T) {
+	receiptStore := store.NewMemoryStore()
+	h := newHandler(t, receiptStore)
+
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+	req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ProcessReceipt(w, req)
+
+	var processed map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&processed); err != nil {
+		t.Fatalf("Failed to decode process response: %v", err)
+	}
+	id := processed["id"]
+
+	w = httptest.NewRecorder()
+	h.GetReceipt(w, httptest.NewRequest("GET", "/receipts/"+id, nil), id)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected HTTP status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var record model.Record
+	if err := json.NewDecoder(w.Body).Decode(&record); err != nil {
+		t.Fatalf("Failed to decode receipt response: %v", err)
+	}
+	if record.ID != id || record.Receipt.Retailer != "Target" || record.Receipt.Total != model.MustParseMoney("1.25") {
+		t.Errorf("Unexpected stored receipt %+v", record)
+	}
+	if record.Points != 37 || record.RuleVersion != rules.Default().Version || record.CreatedAt.IsZero() {
+		t.Errorf("Expected 37 points, rule version and creation time, got %+v", record)
+	}
+
+	w = httptest.NewRecorder()
+	h.GetReceipt(w, httptest.NewRequest("GET", "/receipts/missing", nil), "missing")
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), handler.CodeReceiptNotFound) {
+		t.Errorf("Expected not found error, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// test function for listing receipts with filters and cursor pagination
+func TestListReceipts(t *testing.T) {
+	receiptStore := store.NewMemoryStore()
+	h := newHandler(t, receiptStore)
+
+	retailers := []string{"Target", "Walmart", "Target Express", "Costco", "target"}
+	for i, retailer := range retailers {
+		receiptStore.Put(model.Record{
+			ID:      fmt.Sprintf("r%d", i),
+			Receipt: model.Receipt{Retailer: retailer, PurchaseDate: fmt.Sprintf("2023-09-1%d", i), Total: model.Money(1000 * (i + 1))},
+			Points:  10 * i,
+		})
+	}
+
+	list := func(rawQuery string) (model.Page, int) {
+		w := httptest.NewRecorder()
+		h.ListReceipts(w, httptest.NewRequest("GET", "/receipts?"+rawQuery, nil))
+		var page model.Page
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+				t.Fatalf("Failed to decode list response: %v", err)
+			}
+		}
+		return page, w.Code
+	}
+	ids := func(page model.Page) string {
+		var ids []string
+		for _, record := range page.Records {
+			ids = append(ids, record.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	testCases := []struct {
+		query    string
+		expected string
+	}{
+		{"", "r0,r1,r2,r3,r4"},
+		{"retailer=TARGET", "r0,r2,r4"},
+		{"purchaseDateFrom=2023-09-11&purchaseDateTo=2023-09-13", "r1,r2,r3"},
+		{"minTotal=20.00&maxTotal=40", "r1,r2,r3"},
+		{"minPoints=20", "r2,r3,r4"},
+		{"retailer=target&maxPoints=20", "r0,r2"},
+	}
+	for _, tc := range testCases {
+		page, code := list(tc.query)
+		if code != http.StatusOK || ids(page) != tc.expected || page.NextCursor != "" {
+			t.Errorf("Query %q: expected %s, got %d %s (cursor %q)", tc.query, tc.expected, code, ids(page), page.NextCursor)
+		}
+	}
+
+	// Walk through the target receipts two at a time
+	page, _ := list("retailer=target&limit=2")
+	if ids(page) != "r0,r2" || page.NextCursor == "" {
+		t.Fatalf("Expected first page r0,r2 with a cursor, got %s (cursor %q)", ids(page), page.NextCursor)
+	}
+	page, _ = list("retailer=target&limit=2&cursor=" + page.NextCursor)
+	if ids(page) != "r4" || page.NextCursor != "" {
+		t.Errorf("Expected last page r4 without a cursor, got %s (cursor %q)", ids(page), page.NextCursor)
+	}
+
+	for _, query := range []string{"limit=0", "limit=abc", "cursor=!!", "minTotal=-1", "minPoints=x", "purchaseDateFrom=2023-13-01"} {
+		if _, code := list(query); code != http.StatusBadRequest {
+			t.Errorf("Query %q: expected HTTP status code %d, got %d", query, http.StatusBadRequest, code)
+		}
+	}
+}
+
+// test function for Idempotency-Key handling in the process endpoint
+func TestProcessReceiptIdempotency(t *testing.T) {
+	receiptStore := store.NewMemoryStore()
+	h := newHandler(t, receiptStore)
+
+	process := func(key, body string) (int, string) {
+		req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		h.ProcessReceipt(w, req)
+
+		var response map[string]string
+		json.NewDecoder(w.Body).Decode(&response)
+		return w.Code, response["id"]
+	}
+
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+	code, first := process("retry-1", body)
+	if code != http.StatusOK || first == "" {
+		t.Fatalf("Expected first request to succeed, got %d", code)
+	}
+
+	code, second := process("retry-1", body)
+	if code != http.StatusOK || second != first {
+		t.Errorf("Expected retry to return %s, got %d %s", first, code, second)
+	}
+	if records, _ := receiptStore.List(); len(records) != 1 {
+		t.Errorf("Expected one stored receipt, found %d", len(records))
+	}
+
+	code, _ = process("retry-1", strings.Replace(body, "Target", "Walmart", 1))
+	if code != http.StatusConflict {
+		t.Errorf("Expected HTTP status code %d for a reused key, got %d", http.StatusConflict, code)
+	}
+
+	// A rejected receipt does not use up its key
+	code, _ = process("retry-2", `{"retailer":"Target"}`)
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected HTTP status code %d, got %d", http.StatusBadRequest, code)
+	}
+	code, _ = process("retry-2", body)
+	if code != http.StatusOK {
+		t.Errorf("Expected key to be reusable after a failed request, got %d", code)
+	}
+}
+
+// test function for Idempotency-Key retries that reach a restarted server
+func TestProcessReceiptIdempotencyAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+	process := func(h *handler.Handler) (int, string, string) {
+		req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "deploy-retry")
+		w := httptest.NewRecorder()
+		h.ProcessReceipt(w, req)
+
+		var response map[string]string
+		json.NewDecoder(w.Body).Decode(&response)
+		return w.Code, response["id"], w.Header().Get("Idempotent-Replayed")
+	}
+
+	before, err := store.OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	_, first, _ := process(newHandler(t, before))
+	before.Close()
+
+	after, err := store.OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopening store failed: %v", err)
+	}
+	defer after.Close()
+	h := newHandler(t, after)
+	code, second, replayed := process(h)
+	if code != http.StatusOK || second != first || replayed != "true" {
+		t.Errorf("Expected the retry to replay %s, got %d %s (replayed %q)", first, code, second, replayed)
+	}
+	if n := after.Len(); n != 1 {
+		t.Errorf("Expected one stored receipt, found %d", n)
+	}
+
+	// The key stays with the client that sent it
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest("GET", "/receipts/"+first, nil))
+	if strings.Contains(w.Body.String(), "deploy-retry") {
+		t.Errorf("Expected the stored receipt not to show its idempotency key, got %s", w.Body.String())
+	}
+}
+
+// Testing function for the canonical receipt fingerprint
+func TestFingerprint(t *testing.T) {
+	money := model.MustParseMoney
+	original := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []model.Item{{ShortDescription: "Pepsi 12-oz", Price: money("1.25")}, {ShortDescription: "Dasani", Price: money("1.40")}},
+		Total:        money("2.65"),
+	}
+	resubmitted := model.Receipt{
+		Retailer:     "  TARGET ",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []model.Item{{ShortDescription: "dasani", Price: money("1.40")}, {ShortDescription: "Pepsi   12-OZ", Price: money("1.25")}},
+		Total:        money("2.65"),
+	}
+	different := original
+	different.Total = money("2.66")
+
+	if model.Fingerprint(original) != model.Fingerprint(resubmitted) {
+		t.Errorf("Expected normalized receipts to share a fingerprint")
+	}
+	if model.Fingerprint(original) == model.Fingerprint(different) {
+		t.Errorf("Expected receipts with different totals to have different fingerprints")
+	}
+
+	// The same wall-clock time in two zones is two purchases
+	chicago, honolulu := original, original
+	chicago.TimeZone, honolulu.TimeZone = "America/Chicago", "Pacific/Honolulu"
+	if model.Fingerprint(chicago) == model.Fingerprint(honolulu) || model.Fingerprint(chicago) == model.Fingerprint(original) {
+		t.Errorf("Expected receipts in different time zones to have different fingerprints")
+	}
+}
+
+// test function for the duplicate receipt policies in the process endpoint
+func TestProcessReceiptDuplicates(t *testing.T) {
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+	resubmitted := strings.Replace(body, "Target", "target ", 1)
+
+	process := func(h *handler.Handler, body string) (int, map[string]string) {
+		req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ProcessReceipt(w, req)
+
+		var response map[string]string
+		json.NewDecoder(w.Body).Decode(&response)
+		return w.Code, response
+	}
+
+	testCases := []struct {
+		policy      handler.DuplicatePolicy
+		httpStatus  int
+		stored      int
+		duplicateOf bool
+	}{
+		{handler.DuplicateAllow, http.StatusOK, 2, false},
+		{handler.DuplicateFlag, http.StatusOK, 2, true},
+		{handler.DuplicateReject, http.StatusConflict, 1, true},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			receiptStore := store.NewMemoryStore()
+			h := newHandlerWithOptions(t, receiptStore, handler.Options{DuplicatePolicy: tc.policy})
+
+			_, first := process(h, body)
+			code, second := process(h, resubmitted)
+			if code != tc.httpStatus {
+				t.Errorf("Expected HTTP status code %d, got %d", tc.httpStatus, code)
+			}
+			if (second["duplicateOf"] == first["id"]) != tc.duplicateOf {
+				t.Errorf("Expected duplicateOf %s to be reported: %v, got response %v", first["id"], tc.duplicateOf, second)
+			}
+			if records, _ := receiptStore.List(); len(records) != tc.stored {
+				t.Errorf("Expected %d stored receipts, found %d", tc.stored, len(records))
+			}
+		})
+	}
+}
+
+// fixedIDs hands out a fixed sequence of IDs for testing collisions
+type fixedIDs struct{ ids []string }
+
+func (f *fixedIDs) NewID() string {
+	id := f.ids[0]
+	f.ids = f.ids[1:]
+	return id
+}
+
+// Testing function for the receipt ID generators and store-enforced uniqueness
+func TestReceiptIDs(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	uuids := model.UUIDGenerator{}
+	if id := uuids.NewID(); !uuidPattern.MatchString(id) {
+		t.Errorf("Expected an RFC 4122 version 4 UUID, got %s", id)
+	}
+
+	ulids, err := model.NewIDGenerator("ulid")
+	if err != nil {
+		t.Fatalf("NewIDGenerator failed: %v", err)
+	}
+	previous := ""
+	for i := 0; i < 1000; i++ {
+		id := ulids.NewID()
+		if len(id) != 26 || id <= previous {
+			t.Fatalf("Expected increasing 26 character ULIDs, got %s after %s", id, previous)
+		}
+		previous = id
+	}
+
+	if _, err := model.NewIDGenerator("serial"); err == nil {
+		t.Errorf("Expected an error for an unknown ID kind")
+	}
+
+	// A colliding ID is never overwritten; StoreReceipt moves on to a fresh ID
+	receiptStore := store.NewMemoryStore()
+	receiptStore.Put(model.Record{ID: "taken", Points: 1})
+	id, err := model.StoreReceipt(receiptStore, &fixedIDs{[]string{"taken", "fresh"}}, model.Record{Points: 2})
+	if err != nil || id != "fresh" {
+		t.Errorf("Expected receipt to be stored as fresh, got %q, %v", id, err)
+	}
+	if points, _ := receiptStore.GetPoints("taken"); points != 1 {
+		t.Errorf("Expected the existing receipt to keep 1 point, got %d", points)
+	}
+	if err := receiptStore.Create(model.Record{ID: "taken"}); !errors.Is(err, model.ErrIDExists) {
+		t.Errorf("Expected ErrIDExists, got %v", err)
+	}
+}
+
+// Testing function for reconciling the total against the items under each policy
+func TestProcessReceiptReconcile(t *testing.T) {
+	// A $1.25 item with a $100.00 total is far outside a 15% allowance for tax
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"100.00"}`
+	taxed := strings.Replace(body, "100.00", "1.35", 1)
+
+	tolerance, err := validate.ParseTolerance("15%")
+	if err != nil {
+		t.Fatalf("ParseTolerance failed: %v", err)
+	}
+
+	testCases := []struct {
+		policy     handler.ReconcilePolicy
+		body       string
+		httpStatus int
+		reported   bool
+		annotated  bool
+	}{
+		{handler.ReconcileOff, body, http.StatusOK, false, false},
+		{handler.ReconcileAnnotate, body, http.StatusOK, false, true},
+		{handler.ReconcileFlag, body, http.StatusOK, true, true},
+		{handler.ReconcileReject, body, http.StatusBadRequest, false, false},
+		{handler.ReconcileReject, taxed, http.StatusOK, false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			receiptStore := store.NewMemoryStore()
+			h := newHandlerWithOptions(t, receiptStore, handler.Options{ReconcilePolicy: tc.policy, Tolerance: tolerance})
+
+			req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			h.ProcessReceipt(w, req)
+			if w.Code != tc.httpStatus {
+				t.Fatalf("Expected HTTP status code %d, got %d: %s", tc.httpStatus, w.Code, w.Body.String())
+			}
+
+			var response struct {
+				ID            string                `json:"id"`
+				TotalMismatch *model.TotalMismatch  `json:"totalMismatch"`
+				Errors        []validate.FieldError `json:"errors"`
+			}
+			json.NewDecoder(w.Body).Decode(&response)
+			if tc.httpStatus != http.StatusOK {
+				if len(response.Errors) != 1 || response.Errors[0].Code != validate.FieldTotalMismatch {
+					t.Errorf("Expected a single total_mismatch error, got %v", response.Errors)
+				}
+				return
+			}
+			if (response.TotalMismatch != nil) != tc.reported {
+				t.Errorf("Expected mismatch reported: %v, got %v", tc.reported, response.TotalMismatch)
+			}
+
+			record, _ := receiptStore.Get(response.ID)
+			if (record.TotalMismatch != nil) != tc.annotated {
+				t.Fatalf("Expected mismatch recorded: %v, got %v", tc.annotated, record.TotalMismatch)
+			}
+			if tc.annotated && (record.TotalMismatch.ItemsTotal != 125 || record.TotalMismatch.Difference != 9875 || record.TotalMismatch.Allowed != 19) {
+				t.Errorf("Unexpected mismatch details %+v", *record.TotalMismatch)
+			}
+		})
+	}
+}
+
+// Testing function for filling in receipt time zones from the retailer or the default
+func TestReceiptTimeZones(t *testing.T) {
+	zones := model.Zones{Default: "America/Chicago", Retailers: map[string]string{"target": "Pacific/Honolulu"}}
+	if err := zones.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	testCases := []struct {
+		body     string
+		timeZone string
+	}{
+		{`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"23:00","items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.25"}`, "Pacific/Honolulu"},
+		{`{"retailer":"Walgreens","purchaseDate":"2022-01-01","purchaseTime":"23:00","items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.25"}`, "America/Chicago"},
+		{`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"23:00","timeZone":"Europe/Paris","items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.25"}`, "Europe/Paris"},
+	}
+	for _, tc := range testCases {
+		receiptStore := store.NewMemoryStore()
+		h := newHandlerWithOptions(t, receiptStore, handler.Options{Zones: zones})
+
+		req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ProcessReceipt(w, req)
+
+		var response map[string]string
+		json.NewDecoder(w.Body).Decode(&response)
+		receipt, ok := receiptStore.GetReceipt(response["id"])
+		if !ok || receipt.TimeZone != tc.timeZone {
+			t.Errorf("Expected the receipt to be stored in %s, got %q (%s)", tc.timeZone, receipt.TimeZone, w.Body.String())
+		}
+	}
+
+	if err := (model.Zones{Retailers: map[string]string{"Target": "Nowhere/Special"}}).Validate(); err == nil {
+		t.Errorf("Expected an error for an unknown retailer time zone")
+	}
+	if err := (model.Zones{Default: "Local"}).Validate(); err == nil {
+		t.Errorf("Expected an error for the server's Local time zone")
+	}
+}
+
+// Testing function for routing, including 404 and 405 responses and media type parameters
+func TestRoutes(t *testing.T) {
+	receiptStore := store.NewMemoryStore()
+	receiptStore.Put(model.Record{ID: "abc", Points: 7, RuleVersion: rules.Default().Version})
+	routes := newHandler(t, receiptStore).Routes()
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.25"}`
+
+	testCases := []struct {
+		method      string
+		path        string
+		contentType string
+		httpStatus  int
+		errorCode   string
+		allow       string
+	}{
+		{"POST", "/receipts/process", "application/json", http.StatusOK, "", ""},
+		{"POST", "/receipts/process", "application/json; charset=utf-8", http.StatusOK, "", ""},
+		{"POST", "/receipts/process", "Application/JSON", http.StatusOK, "", ""},
+		{"POST", "/receipts/process", "text/plain", http.StatusUnsupportedMediaType, handler.CodeUnsupportedMediaType, ""},
+		{"POST", "/receipts/process", "", http.StatusUnsupportedMediaType, handler.CodeUnsupportedMediaType, ""},
+		{"GET", "/receipts/process", "", http.StatusMethodNotAllowed, handler.CodeMethodNotAllowed, "POST"},
+		{"GET", "/receipts/abc", "", http.StatusOK, "", ""},
+		{"HEAD", "/receipts/abc", "", http.StatusOK, "", ""},
+		{"DELETE", "/receipts/abc", "", http.StatusMethodNotAllowed, handler.CodeMethodNotAllowed, "GET, HEAD"},
+		{"GET", "/receipts/abc/points", "", http.StatusOK, "", ""},
+		{"GET", "/receipts/abc/points/breakdown", "", http.StatusOK, "", ""},
+		{"GET", "/receipts/abc/points/extra", "", http.StatusNotFound, handler.CodeNotFound, ""},
+		{"GET", "/receipts/abc/total", "", http.StatusNotFound, handler.CodeNotFound, ""},
+		{"GET", "/receipts/", "", http.StatusNotFound, handler.CodeNotFound, ""},
+		{"GET", "/receipts/missing", "", http.StatusNotFound, handler.CodeReceiptNotFound, ""},
+		{"GET", "/nowhere", "", http.StatusNotFound, handler.CodeNotFound, ""},
+		{"PUT", "/admin/rescore", "application/json", http.StatusMethodNotAllowed, handler.CodeMethodNotAllowed, "POST"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.path+" "+tc.contentType, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, req)
+
+			if w.Code != tc.httpStatus {
+				t.Fatalf("Expected HTTP status code %d, got %d: %s", tc.httpStatus, w.Code, w.Body.String())
+			}
+			if allow := w.Header().Get("Allow"); allow != tc.allow {
+				t.Errorf("Expected Allow %q, got %q", tc.allow, allow)
+			}
+			if tc.errorCode != "" {
+				var problem handler.Problem
+				json.NewDecoder(w.Body).Decode(&problem)
+				if problem.Code != tc.errorCode {
+					t.Errorf("Expected error code %s, got %s", tc.errorCode, problem.Code)
+				}
+			}
+		})
+	}
+}
+
+// Testing function for rejecting request bodies over the size limit
+func TestMaxBodyBytes(t *testing.T) {
+	routes := newHandlerWithOptions(t, store.NewMemoryStore(), handler.Options{MaxBodyBytes: 64}).Routes()
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.25"}`
+
+	for _, idempotencyKey := range []string{"", "key-1"} {
+		req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if idempotencyKey != "" {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, req)
+
+		var problem handler.Problem
+		json.NewDecoder(w.Body).Decode(&problem)
+		if w.Code != http.StatusRequestEntityTooLarge || problem.Code != handler.CodeBodyTooLarge {
+			t.Errorf("Expected 413 %s, got %d %s", handler.CodeBodyTooLarge, w.Code, problem.Code)
+		}
+	}
+}
+
+// Testing function for the health, readiness and version endpoints
+func TestOperationalEndpoints(t *testing.T) {
+	fileStore, err := store.OpenFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	defer fileStore.Close()
+	h := newHandlerWithOptions(t, fileStore, handler.Options{Build: handler.BuildInfo{Version: "1.2.0", Commit: "abc123"}})
+	routes := h.Routes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Errorf("Expected /healthz to be 200, got %d", w.Code)
+	}
+	if w := get("/readyz"); w.Code != http.StatusOK {
+		t.Errorf("Expected /readyz to be 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var version struct {
+		Version     string `json:"version"`
+		Commit      string `json:"commit"`
+		GoVersion   string `json:"goVersion"`
+		RuleVersion string `json:"ruleVersion"`
+	}
+	json.NewDecoder(get("/version").Body).Decode(&version)
+	if version.Version != "1.2.0" || version.Commit != "abc123" || version.GoVersion == "" || version.RuleVersion != rules.Default().Version {
+		t.Errorf("Unexpected version response %+v", version)
+	}
+
+	// Readiness fails while shutting down and once the store is closed, but the process stays alive
+	h.StartShutdown()
+	fileStore.Close()
+	w := get("/readyz")
+	var problem handler.Problem
+	json.NewDecoder(w.Body).Decode(&problem)
+	if w.Code != http.StatusServiceUnavailable || problem.Code != handler.CodeNotReady {
+		t.Errorf("Expected 503 %s, got %d %s", handler.CodeNotReady, w.Code, problem.Code)
+	}
+	for _, reason := range []string{"shutting down", "store"} {
+		if !strings.Contains(problem.Detail, reason) {
+			t.Errorf("Expected readiness detail to mention %q, got %q", reason, problem.Detail)
+		}
+	}
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Errorf("Expected /healthz to stay 200 while shutting down, got %d", w.Code)
+	}
+}
+
+// Testing function for the metrics recorded while processing receipts
+func TestMetrics(t *testing.T) {
+	routes := newHandlerWithOptions(t, store.NewMemoryStore(), handler.Options{DuplicatePolicy: handler.DuplicateReject}).Routes()
+	valid := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.25"}`
+	invalid := `{"retailer":"","purchaseDate":"2022-13-01","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi","price":"x"}],"total":"1.25"}`
+
+	for _, body := range []string{valid, valid, invalid, "{"} {
+		req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		routes.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	routes.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nowhere", nil))
+	// Methods no route answers share one series however many a client invents
+	routes.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("FOO1", "/receipts/process", nil))
+	routes.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("FOO2", "/nowhere", nil))
+
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the Prometheus text format, got %q", contentType)
+	}
+	scrape := w.Body.String()
+
+	for _, line := range []string{
+		"receipts_processed_total 1",
+		`receipts_rejected_total{reason="duplicate_receipt"} 1`,
+		`receipts_rejected_total{reason="invalid_date_format"} 1`,
+		`receipts_rejected_total{reason="invalid_json"} 1`,
+		`receipts_rejected_total{reason="invalid_price_format"} 1`,
+		`receipts_rejected_total{reason="missing_field"} 1`,
+		`receipt_points_bucket{le="+Inf"} 1`,
+		"receipt_points_sum 37",
+		`receipt_rule_fires_total{rule="retailer_alphanumeric"} 1`,
+		`http_request_duration_seconds_count{method="POST",route="/receipts/process",code="200"} 1`,
+		`http_request_duration_seconds_count{method="POST",route="/receipts/process",code="409"} 1`,
+		`http_request_duration_seconds_count{method="POST",route="/receipts/process",code="400"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="unmatched",code="404"} 1`,
+		`http_request_duration_seconds_count{method="other",route="/receipts/process",code="405"} 1`,
+		`http_request_duration_seconds_count{method="other",route="unmatched",code="404"} 1`,
+		"receipts_stored 1",
+	} {
+		if !strings.Contains(scrape, line+"\n") {
+			t.Errorf("Expected the scrape to contain %q, got:\n%s", line, scrape)
+		}
+	}
+	if strings.Contains(scrape, "FOO") {
+		t.Errorf("Expected unknown methods to be recorded as other, got:\n%s", scrape)
+	}
+}
+
+// Testing function for guarding administration endpoints with the admin token
+func TestAdminToken(t *testing.T) {
+	testCases := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		httpStatus    int
+		errorCode     string
+	}{
+		{"disabled without a token", "", "Bearer ", http.StatusForbidden, handler.CodeAdminDisabled},
+		{"missing header", "s3cret", "", http.StatusUnauthorized, handler.CodeUnauthorized},
+		{"wrong token", "s3cret", "Bearer guess", http.StatusUnauthorized, handler.CodeUnauthorized},
+		{"wrong scheme", "s3cret", "Basic s3cret", http.StatusUnauthorized, handler.CodeUnauthorized},
+		{"valid token", "s3cret", "Bearer s3cret", http.StatusOK, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			routes := newHandlerWithOptions(t, store.NewMemoryStore(), handler.Options{AdminToken: tc.adminToken}).Routes()
+			req := httptest.NewRequest("POST", "/admin/rescore", bytes.NewBufferString(`{"commit": true}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, req)
+
+			if w.Code != tc.httpStatus {
+				t.Fatalf("Expected HTTP status code %d, got %d: %s", tc.httpStatus, w.Code, w.Body.String())
+			}
+			if tc.errorCode != "" {
+				var problem handler.Problem
+				json.NewDecoder(w.Body).Decode(&problem)
+				if problem.Code != tc.errorCode {
+					t.Errorf("Expected error code %s, got %s", tc.errorCode, problem.Code)
+				}
+			}
+		})
 	}
 }
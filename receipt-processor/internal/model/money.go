@@ -0,0 +1,157 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount of money stored as a whole number of cents.
+// It is encoded in JSON as a decimal string such as "10.25".
+type Money int64
+
+// MaxMoney is the largest amount a receipt may state, $10,000,000.00. Together with MaxLines and
+// MaxQuantity it keeps every sum over a receipt, and every product with a quantity, far below the
+// int64 limit.
+const MaxMoney Money = 10_000_000_00
+
+// Limits on the size of a receipt
+const (
+	// MaxLines is the most items, taxes or discounts a receipt may list.
+	MaxLines = 10_000
+	// MaxQuantity is the largest quantity of a single item.
+	MaxQuantity = 100_000
+)
+
+// ErrInvalidMoney is returned when a string is not a valid price in dollars and cents.
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// ErrMoneyOutOfRange is returned when an amount is larger than MaxMoney.
+var ErrMoneyOutOfRange = fmt.Errorf("%w: larger than %s", ErrInvalidMoney, MaxMoney)
+
+// The price must start with one or more digits (\d+).
+// Optionally, it can have a decimal point followed by exactly two digits (\.\d{2})
+var validPrice = regexp.MustCompile(`^(\d+)(?:\.(\d{2}))?$`)
+
+// IsValidPrice checks if a given price string is a valid price in terms of dollars and cents.
+func IsValidPrice(price string) bool {
+	return validPrice.MatchString(price)
+}
+
+// ParseMoney parses a price string such as "10", "0.29" or "1234.50" without going through floating point.
+// Amounts larger than MaxMoney fail with ErrMoneyOutOfRange.
+func ParseMoney(price string) (Money, error) {
+	match := validPrice.FindStringSubmatch(price)
+	if match == nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, price)
+	}
+
+	dollars, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || dollars > MaxMoney.Cents()/100 {
+		return 0, fmt.Errorf("%w: %q", ErrMoneyOutOfRange, price)
+	}
+	var cents int64
+	if match[2] != "" {
+		cents, _ = strconv.ParseInt(match[2], 10, 64)
+	}
+	if amount := Money(dollars*100 + cents); amount <= MaxMoney {
+		return amount, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrMoneyOutOfRange, price)
+}
+
+// MustParseMoney is like ParseMoney but panics if the price is invalid.
+// It is meant for constants in code and tests.
+func MustParseMoney(price string) Money {
+	m, err := ParseMoney(price)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Cents returns the amount as a whole number of cents.
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// String formats the amount with exactly two decimal places.
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// MarshalJSON encodes the amount as a decimal string.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON decodes a decimal string such as "10.25". Numbers and negative amounts are rejected.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var price string
+	if err := json.Unmarshal(data, &price); err != nil {
+		return fmt.Errorf("%w: %s is not a string", ErrInvalidMoney, data)
+	}
+	parsed, err := ParseMoney(price)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// SignedMoney is an amount worked out from a receipt rather than read from one, such as the
+// difference between its total and its items. Unlike Money it may be negative or larger than
+// MaxMoney. It is encoded in JSON as a decimal string such as "-49.00".
+type SignedMoney int64
+
+// Cents returns the amount as a whole number of cents.
+func (m SignedMoney) Cents() int64 {
+	return int64(m)
+}
+
+// String formats the amount with exactly two decimal places and a leading '-' when negative.
+func (m SignedMoney) String() string {
+	return Money(m).String()
+}
+
+// MarshalJSON encodes the amount as a decimal string.
+func (m SignedMoney) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON decodes a decimal string such as "10.25" or "-49.00".
+func (m *SignedMoney) UnmarshalJSON(data []byte) error {
+	var amount string
+	if err := json.Unmarshal(data, &amount); err != nil {
+		return fmt.Errorf("%w: %s is not a string", ErrInvalidMoney, data)
+	}
+	digits, negative := strings.CutPrefix(amount, "-")
+	match := validPrice.FindStringSubmatch(digits)
+	if match == nil {
+		return fmt.Errorf("%w: %q", ErrInvalidMoney, amount)
+	}
+	dollars, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || dollars >= math.MaxInt64/100 {
+		return fmt.Errorf("%w: %q", ErrInvalidMoney, amount)
+	}
+	var cents int64
+	if match[2] != "" {
+		cents, _ = strconv.ParseInt(match[2], 10, 64)
+	}
+	parsed := dollars*100 + cents
+	if negative {
+		parsed = -parsed
+	}
+	*m = SignedMoney(parsed)
+	return nil
+}
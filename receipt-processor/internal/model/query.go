@@ -0,0 +1,71 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Query filters and pages through stored records in ID order. Zero-valued filters match everything.
+type Query struct {
+	Retailer  string // case-insensitive substring of the retailer name
+	DateFrom  string // earliest purchase date, inclusive, "2006-01-02"
+	DateTo    string // latest purchase date, inclusive, "2006-01-02"
+	MinTotal  *Money
+	MaxTotal  *Money
+	MinPoints *int
+	MaxPoints *int
+	After     string // only records with an ID after this one; taken from a page cursor
+	Limit     int    // maximum number of records in a page
+}
+
+// Page is one page of query results. NextCursor is empty on the last page.
+type Page struct {
+	Records    []Record `json:"receipts"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+// ErrInvalidCursor is returned when a page cursor was not produced by EncodeCursor.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Matches reports whether a record passes every filter in the query. Paging fields are ignored.
+func (q Query) Matches(record Record) bool {
+	receipt := record.Receipt
+	if q.Retailer != "" && !strings.Contains(strings.ToLower(receipt.Retailer), strings.ToLower(q.Retailer)) {
+		return false
+	}
+	// Dates are zero-padded "2006-01-02" strings, so they compare correctly as strings
+	if q.DateFrom != "" && receipt.PurchaseDate < q.DateFrom {
+		return false
+	}
+	if q.DateTo != "" && receipt.PurchaseDate > q.DateTo {
+		return false
+	}
+	if q.MinTotal != nil && receipt.Total < *q.MinTotal {
+		return false
+	}
+	if q.MaxTotal != nil && receipt.Total > *q.MaxTotal {
+		return false
+	}
+	if q.MinPoints != nil && record.Points < *q.MinPoints {
+		return false
+	}
+	if q.MaxPoints != nil && record.Points > *q.MaxPoints {
+		return false
+	}
+	return true
+}
+
+// EncodeCursor turns the ID of the last record on a page into an opaque cursor for the next page.
+func EncodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// DecodeCursor recovers the record ID from a cursor produced by EncodeCursor.
+func DecodeCursor(cursor string) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(id) == 0 {
+		return "", ErrInvalidCursor
+	}
+	return string(id), nil
+}
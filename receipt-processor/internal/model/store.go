@@ -0,0 +1,94 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// Record is a stored receipt together with the points awarded for it,
+// the version of the rule set that computed them and when it was stored.
+// DuplicateOf is set when the receipt was accepted as a flagged duplicate of an earlier one,
+// TotalMismatch when its total did not reconcile with its items, and Idempotency when it was
+// submitted with an Idempotency-Key.
+type Record struct {
+	ID            string         `json:"id"`
+	Receipt       Receipt        `json:"receipt"`
+	Points        int            `json:"points"`
+	RuleVersion   string         `json:"ruleVersion"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	Fingerprint   string         `json:"fingerprint,omitempty"`
+	DuplicateOf   string         `json:"duplicateOf,omitempty"`
+	TotalMismatch *TotalMismatch `json:"totalMismatch,omitempty"`
+	Idempotency   *Idempotency   `json:"idempotency,omitempty"`
+}
+
+// Idempotency is the Idempotency-Key a receipt was submitted with and a hash of the request body.
+// It is stored with the receipt so a retry after a restart still gets the original ID, until the
+// idempotency window has passed since CreatedAt. It is never shown to clients.
+type Idempotency struct {
+	Key         string `json:"key"`
+	RequestHash string `json:"requestHash"`
+}
+
+// TotalMismatch records how far a receipt's total was from the sum of its item prices
+// when the difference was more than the configured tolerance. The amounts are signed, since
+// a total below its items gives a negative difference.
+type TotalMismatch struct {
+	ItemsTotal SignedMoney `json:"itemsTotal"`
+	Difference SignedMoney `json:"difference"` // total minus the items sum
+	Allowed    SignedMoney `json:"allowed"`
+}
+
+// ReceiptStore is the storage backend for processed receipts.
+// Implementations must be safe for concurrent use.
+type ReceiptStore interface {
+	// Create saves a new record, failing with ErrIDExists if a record with its ID is already stored.
+	Create(record Record) error
+	// Put saves a record under its ID, replacing any existing record with that ID.
+	Put(record Record) error
+	// PutAll saves several records atomically: either all of them are saved or none are.
+	PutAll(records []Record) error
+	// Get retrieves the full record stored under an ID.
+	Get(id string) (Record, bool)
+	// FindByFingerprint retrieves the earliest stored record with the given content fingerprint.
+	FindByFingerprint(fingerprint string) (Record, bool)
+	// GetReceipt retrieves the receipt stored under an ID.
+	GetReceipt(id string) (Receipt, bool)
+	// GetPoints retrieves the points awarded to the receipt stored under an ID.
+	GetPoints(id string) (int, bool)
+	// List returns every stored record ordered by ID.
+	List() ([]Record, error)
+	// Query returns one page of records matching the query, ordered by ID.
+	Query(query Query) (Page, error)
+	// Delete removes the record stored under an ID and reports whether it existed.
+	Delete(id string) (bool, error)
+	// Len returns the number of stored records.
+	Len() int
+	// Ping reports an error when the store can no longer save records, for example after it is closed.
+	Ping() error
+}
+
+// ErrIDExists is returned by ReceiptStore.Create when the record's ID is already taken.
+var ErrIDExists = errors.New("receipt ID already exists")
+
+// maxIDAttempts bounds how many fresh IDs StoreReceipt tries before giving up.
+const maxIDAttempts = 5
+
+// StoreReceipt saves a scored record in the store under a newly generated ID, stamps its
+// creation time and returns the ID. The store guarantees the ID is unique; on the rare
+// collision a new ID is generated.
+func StoreReceipt(store ReceiptStore, ids IDGenerator, record Record) (string, error) {
+	record.CreatedAt = time.Now().UTC()
+
+	for attempt := 0; attempt < maxIDAttempts; attempt++ {
+		record.ID = ids.NewID()
+		err := store.Create(record)
+		if err == nil {
+			return record.ID, nil
+		}
+		if !errors.Is(err, ErrIDExists) {
+			return "", err
+		}
+	}
+	return "", ErrIDExists
+}
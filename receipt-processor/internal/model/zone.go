@@ -0,0 +1,98 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	// Embed the time zone database so IANA zones resolve even on hosts without one installed
+	_ "time/tzdata"
+)
+
+// errLocalZone rejects "Local", which time.LoadLocation takes to mean the server's own zone.
+var errLocalZone = errors.New(`"Local" is not an IANA time zone`)
+
+// LoadZone resolves an IANA time zone name, or UTC when the name is empty. Unlike
+// time.LoadLocation it refuses "Local", so a zone never depends on where the server runs.
+func LoadZone(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, errLocalZone
+	}
+	return time.LoadLocation(name)
+}
+
+// Location returns the receipt's time zone, or UTC when it has none.
+func (r Receipt) Location() (*time.Location, error) {
+	return LoadZone(r.TimeZone)
+}
+
+// PurchasedAt returns the moment of purchase. The purchase date and time are the wall-clock
+// time printed on the receipt, so they are read in the receipt's time zone.
+func (r Receipt) PurchasedAt() (time.Time, error) {
+	location, err := r.Location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation("2006-01-02 15:04", r.PurchaseDate+" "+r.PurchaseTime, location)
+}
+
+// Zones decides the time zone of receipts that do not give their own: the zone of their retailer
+// if one is configured, otherwise the default zone.
+type Zones struct {
+	Default   string            `json:"default,omitempty"`   // IANA zone name; empty means UTC
+	Retailers map[string]string `json:"retailers,omitempty"` // retailer name, matched case-insensitively, to IANA zone name
+}
+
+// LoadZones reads retailer time zones from a JSON file such as
+// {"default": "America/Chicago", "retailers": {"Target": "America/Los_Angeles"}}.
+func LoadZones(path string) (Zones, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Zones{}, fmt.Errorf("read time zones: %w", err)
+	}
+
+	var zones Zones
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&zones); err != nil {
+		return Zones{}, fmt.Errorf("%s: decode time zones: %w", path, err)
+	}
+	if err := zones.Validate(); err != nil {
+		return Zones{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return zones, nil
+}
+
+// Validate checks that every configured zone is a known IANA zone.
+func (z Zones) Validate() error {
+	if _, err := LoadZone(z.Default); err != nil {
+		return fmt.Errorf("default time zone: %w", err)
+	}
+	for retailer, zone := range z.Retailers {
+		if zone == "" {
+			return fmt.Errorf("time zone for retailer %q is empty", retailer)
+		}
+		if _, err := LoadZone(zone); err != nil {
+			return fmt.Errorf("time zone for retailer %q: %w", retailer, err)
+		}
+	}
+	return nil
+}
+
+// Apply fills in the time zone of a receipt that does not give its own.
+func (z Zones) Apply(receipt *Receipt) {
+	if receipt.TimeZone != "" {
+		return
+	}
+	retailer := normalize(receipt.Retailer)
+	for name, zone := range z.Retailers {
+		if normalize(name) == retailer {
+			receipt.TimeZone = zone
+			return
+		}
+	}
+	receipt.TimeZone = z.Default
+}
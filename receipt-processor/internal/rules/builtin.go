@@ -0,0 +1,413 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"receipt-processor/internal/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule type names used in configuration files
+const (
+	TypeRetailerAlphanumeric = "retailer_alphanumeric"
+	TypeTotalMultiple        = "total_multiple"
+	TypeItemGroups           = "item_groups"
+	TypeDescriptionLength    = "description_length"
+	TypeOddDay               = "odd_day"
+	TypeTimeWindow           = "time_window"
+	TypePointsPerDollar      = "points_per_dollar"
+)
+
+// ruleName holds the fields shared by every rule. Name identifies the rule in a breakdown
+// and defaults to the rule type, so the same type can appear more than once with different names.
+type ruleName struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// name returns the configured rule name, or the rule type when none was given.
+func (n ruleName) name(ruleType string) string {
+	if n.Name != "" {
+		return n.Name
+	}
+	return ruleType
+}
+
+// RetailerAlphanumeric awards points for every alphanumeric character in the retailer name.
+// Charset decides which characters count: ASCII letters and digits by default, letters and digits
+// in any script, or those after compatibility decomposition.
+type RetailerAlphanumeric struct {
+	ruleName
+	PointsPerCharacter int    `json:"pointsPerCharacter"`
+	Charset            string `json:"charset,omitempty"`
+}
+
+var isAlphanumeric = regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString
+
+// Apply counts the alphanumeric characters in the retailer name.
+func (r *RetailerAlphanumeric) Apply(receipt model.Receipt) Result {
+	alphanumerics := countCharacters(receipt.Retailer, r.Charset)
+	return Result{
+		Rule:   r.name(TypeRetailerAlphanumeric),
+		Points: alphanumerics * r.PointsPerCharacter,
+		Reason: fmt.Sprintf("retailer name %q has %d alphanumeric characters", receipt.Retailer, alphanumerics),
+	}
+}
+
+// Validate checks the rule parameters.
+func (r *RetailerAlphanumeric) Validate() error {
+	if r.PointsPerCharacter <= 0 {
+		return fmt.Errorf("pointsPerCharacter must be positive")
+	}
+	switch r.Charset {
+	case "", CharsetASCII, CharsetUnicode, CharsetNFKD:
+		return nil
+	}
+	return fmt.Errorf("unknown charset %q: must be ascii, unicode or nfkd", r.Charset)
+}
+
+// TotalMultiple awards points when a receipt amount is an exact multiple of an amount,
+// e.g. "1.00" for round dollar totals or "0.25" for quarters. Amount names the receipt amount
+// to check, such as "subtotal" or "tip", and defaults to the total.
+type TotalMultiple struct {
+	ruleName
+	Amount   string      `json:"amount,omitempty"`
+	Multiple model.Money `json:"multiple"`
+	Points   int         `json:"points"`
+}
+
+// Apply checks whether the amount is a multiple of the configured amount.
+func (r *TotalMultiple) Apply(receipt model.Receipt) Result {
+	result := Result{Rule: r.name(TypeTotalMultiple)}
+	name := amountName(r.Amount)
+	amount, ok := receipt.Amount(name)
+	switch {
+	case !ok || amount <= 0:
+		result.Reason = fmt.Sprintf("receipt has no %s", name)
+	case amount.Cents()%r.Multiple.Cents() == 0:
+		result.Points = r.Points
+		result.Reason = fmt.Sprintf("%s %s is a multiple of %s", name, amount, r.Multiple)
+	default:
+		result.Reason = fmt.Sprintf("%s %s is not a multiple of %s", name, amount, r.Multiple)
+	}
+	return result
+}
+
+// Validate checks the rule parameters.
+func (r *TotalMultiple) Validate() error {
+	if r.Multiple <= 0 {
+		return fmt.Errorf("multiple must be positive")
+	}
+	return validateAmountName(r.Amount)
+}
+
+// PointsPerDollar awards points for every whole dollar of a receipt amount, such as the pre-tax subtotal.
+type PointsPerDollar struct {
+	ruleName
+	Amount string `json:"amount"`
+	Points int    `json:"points"`
+}
+
+// Apply counts the whole dollars of the amount.
+func (r *PointsPerDollar) Apply(receipt model.Receipt) Result {
+	result := Result{Rule: r.name(TypePointsPerDollar)}
+	amount, ok := receipt.Amount(r.Amount)
+	if !ok || amount <= 0 {
+		result.Reason = fmt.Sprintf("receipt has no %s", r.Amount)
+		return result
+	}
+	dollars := int(amount.Cents() / 100)
+	result.Points = dollars * r.Points
+	result.Reason = fmt.Sprintf("%s %s has %d whole dollars at %d points each", r.Amount, amount, dollars, r.Points)
+	return result
+}
+
+// Validate checks the rule parameters.
+func (r *PointsPerDollar) Validate() error {
+	if r.Amount == "" {
+		return fmt.Errorf("amount is required")
+	}
+	if r.Points <= 0 {
+		return fmt.Errorf("points must be positive")
+	}
+	return validateAmountName(r.Amount)
+}
+
+// amountName returns the configured receipt amount, or the total when none was given.
+func amountName(name string) string {
+	if name == "" {
+		return model.AmountTotal
+	}
+	return name
+}
+
+// validateAmountName checks that an optional amount parameter names a known receipt amount.
+func validateAmountName(name string) error {
+	if name != "" && !model.IsAmountName(name) {
+		return fmt.Errorf("unknown amount %q: must be total, subtotal, preTax, tax, discount or tip", name)
+	}
+	return nil
+}
+
+// Ways of counting the items on a receipt
+const (
+	CountLines = "lines" // every item line counts once
+	CountUnits = "units" // every unit counts, so "3 x Gatorade" counts three times
+)
+
+// ItemGroups awards points for every complete group of items, e.g. every two items.
+// Count decides whether items are counted as lines or units, and defaults to lines.
+type ItemGroups struct {
+	ruleName
+	GroupSize int    `json:"groupSize"`
+	Points    int    `json:"points"`
+	Count     string `json:"count,omitempty"`
+}
+
+// Apply counts the complete groups of items on the receipt.
+func (r *ItemGroups) Apply(receipt model.Receipt) Result {
+	count, noun := len(receipt.Items), "items"
+	if r.Count == CountUnits {
+		count, noun = 0, "units"
+		for _, item := range receipt.Items {
+			count += item.Units()
+		}
+	}
+	groups := count / r.GroupSize
+	return Result{
+		Rule:   r.name(TypeItemGroups),
+		Points: groups * r.Points,
+		Reason: fmt.Sprintf("%d %s make %d groups of %d at %d points each", count, noun, groups, r.GroupSize, r.Points),
+	}
+}
+
+// Validate checks the rule parameters.
+func (r *ItemGroups) Validate() error {
+	if r.GroupSize <= 0 {
+		return fmt.Errorf("groupSize must be positive")
+	}
+	if r.Count != "" && r.Count != CountLines && r.Count != CountUnits {
+		return fmt.Errorf("unknown count %q: must be lines or units", r.Count)
+	}
+	return nil
+}
+
+// DescriptionLength awards a fraction of an item's price, rounded up to a whole point, when the
+// trimmed length of the item description is a multiple of Divisor.
+type DescriptionLength struct {
+	ruleName
+	Divisor         int     `json:"divisor"`
+	PriceMultiplier Decimal `json:"priceMultiplier"`
+}
+
+// Apply scores every item whose trimmed description length is a multiple of the divisor.
+func (r *DescriptionLength) Apply(receipt model.Receipt) Result {
+	points := 0
+	var matched []string
+	for i, item := range receipt.Items {
+		if len(strings.TrimSpace(item.ShortDescription))%r.Divisor == 0 {
+			additionalPoints := r.PriceMultiplier.MulCeil(item.Price)
+			points += additionalPoints
+			matched = append(matched, fmt.Sprintf("items[%d] (%d points)", i, additionalPoints))
+		}
+	}
+
+	reason := fmt.Sprintf("no trimmed item description length is a multiple of %d", r.Divisor)
+	if len(matched) > 0 {
+		reason = fmt.Sprintf("trimmed description length is a multiple of %d, awarding %s of the price rounded up for %s",
+			r.Divisor, r.PriceMultiplier, strings.Join(matched, ", "))
+	}
+	return Result{Rule: r.name(TypeDescriptionLength), Points: points, Reason: reason}
+}
+
+// Validate checks the rule parameters.
+func (r *DescriptionLength) Validate() error {
+	if r.Divisor <= 0 {
+		return fmt.Errorf("divisor must be positive")
+	}
+	if r.PriceMultiplier.denominator == 0 {
+		return fmt.Errorf("priceMultiplier is required")
+	}
+	return nil
+}
+
+// zoned holds the optional time zone a rule evaluates the purchase in. Without one the rule uses
+// the local date and time printed on the receipt; with one the purchase is converted to that zone,
+// e.g. to run a promotion on head office time.
+type zoned struct {
+	TimeZone string `json:"timeZone,omitempty"`
+
+	location *time.Location
+}
+
+// loadZone resolves the configured time zone.
+func (z *zoned) loadZone() error {
+	if z.TimeZone == "" {
+		return nil
+	}
+	location, err := model.LoadZone(z.TimeZone)
+	if err != nil {
+		return fmt.Errorf("invalid timeZone %q", z.TimeZone)
+	}
+	z.location = location
+	return nil
+}
+
+// purchasedAt returns the purchase date and time, in the rule's time zone when it has one.
+func (z zoned) purchasedAt(receipt model.Receipt) time.Time {
+	t, err := receipt.PurchasedAt()
+	if err != nil {
+		// Fall back to the printed date and time so a single bad field doesn't hide the other
+		date, _ := time.Parse("2006-01-02", receipt.PurchaseDate)
+		clock, _ := time.Parse("15:04", receipt.PurchaseTime)
+		return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, time.UTC)
+	}
+	if z.location != nil {
+		t = t.In(z.location)
+	}
+	return t
+}
+
+// in describes the rule's time zone for a result reason.
+func (z zoned) in() string {
+	if z.TimeZone == "" {
+		return ""
+	}
+	return " in " + z.TimeZone
+}
+
+// OddDay awards points when the day of the purchase date is odd.
+type OddDay struct {
+	ruleName
+	zoned
+	Points int `json:"points"`
+}
+
+// Apply checks the day of the purchase date.
+func (r *OddDay) Apply(receipt model.Receipt) Result {
+	result := Result{Rule: r.name(TypeOddDay)}
+	t := r.purchasedAt(receipt)
+	if t.Day()%2 == 1 {
+		result.Points = r.Points
+		result.Reason = fmt.Sprintf("purchase day %d%s is odd", t.Day(), r.in())
+	} else {
+		result.Reason = fmt.Sprintf("purchase day %d%s is even", t.Day(), r.in())
+	}
+	return result
+}
+
+// Validate checks the rule parameters.
+func (r *OddDay) Validate() error {
+	return r.loadZone()
+}
+
+// TimeWindow awards points when the purchase time is strictly after After and strictly before Before.
+// Both bounds are "15:04" formatted times of day.
+type TimeWindow struct {
+	ruleName
+	zoned
+	After  string `json:"after"`
+	Before string `json:"before"`
+	Points int    `json:"points"`
+
+	after, before int // minutes past midnight
+}
+
+// Apply checks whether the purchase time falls inside the window.
+func (r *TimeWindow) Apply(receipt model.Receipt) Result {
+	result := Result{Rule: r.name(TypeTimeWindow)}
+	t := r.purchasedAt(receipt)
+	minutesPastMidnight := t.Hour()*60 + t.Minute() // t.hour only gives hours, needs minutes too
+	if minutesPastMidnight > r.after && minutesPastMidnight < r.before {
+		result.Points = r.Points
+		result.Reason = fmt.Sprintf("purchase time %s%s is after %s and before %s", t.Format("15:04"), r.in(), r.After, r.Before)
+	} else {
+		result.Reason = fmt.Sprintf("purchase time %s%s is not after %s and before %s", t.Format("15:04"), r.in(), r.After, r.Before)
+	}
+	return result
+}
+
+// Validate parses the window bounds.
+func (r *TimeWindow) Validate() error {
+	after, err := time.Parse("15:04", r.After)
+	if err != nil {
+		return fmt.Errorf("invalid after time %q", r.After)
+	}
+	before, err := time.Parse("15:04", r.Before)
+	if err != nil {
+		return fmt.Errorf("invalid before time %q", r.Before)
+	}
+	r.after = after.Hour()*60 + after.Minute()
+	r.before = before.Hour()*60 + before.Minute()
+	if r.after >= r.before {
+		return fmt.Errorf("after %s must be earlier than before %s", r.After, r.Before)
+	}
+	return r.loadZone()
+}
+
+// Decimal is an exact non-negative decimal factor such as "0.2", used to scale prices without floating point.
+type Decimal struct {
+	text        string
+	numerator   int64
+	denominator int64
+}
+
+var validDecimal = regexp.MustCompile(`^(\d+)(?:\.(\d{1,6}))?$`)
+
+// maxDecimal is the largest factor accepted. With amounts capped at model.MaxMoney, MulCeil's
+// product of cents and numerator then stays below 10^18, well within int64.
+const maxDecimal = 1000
+
+// ParseDecimal parses a decimal string with up to six fractional digits, no larger than 1000.
+func ParseDecimal(s string) (Decimal, error) {
+	match := validDecimal.FindStringSubmatch(s)
+	if match == nil {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	numerator, err := strconv.ParseInt(match[1]+match[2], 10, 64)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("invalid decimal %q: %w", s, err)
+	}
+	denominator := int64(1)
+	for range match[2] {
+		denominator *= 10
+	}
+	if numerator > maxDecimal*denominator {
+		return Decimal{}, fmt.Errorf("invalid decimal %q: must be at most %d", s, maxDecimal)
+	}
+	return Decimal{text: s, numerator: numerator, denominator: denominator}, nil
+}
+
+// MulCeil multiplies an amount in dollars by the decimal and rounds up to a whole number.
+func (d Decimal) MulCeil(m model.Money) int {
+	divisor := d.denominator * 100
+	product := m.Cents() * d.numerator
+	return int((product + divisor - 1) / divisor)
+}
+
+// String returns the decimal as it was written.
+func (d Decimal) String() string {
+	return d.text
+}
+
+// MarshalJSON encodes the decimal as a string.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.text)
+}
+
+// UnmarshalJSON decodes a decimal string such as "0.2".
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("decimal must be a string: %w", err)
+	}
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,41 @@
+package rules
+
+import (
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Character classes the retailer_alphanumeric rule can count
+const (
+	CharsetASCII   = "ascii"   // only a-z, A-Z and 0-9
+	CharsetUnicode = "unicode" // letters and decimal digits in any script
+	CharsetNFKD    = "nfkd"    // as unicode, after NFKD normalization, so "ﬁ" counts as "fi" and "㍿" as "株式会社"
+)
+
+// countCharacters counts the characters of s that belong to a charset.
+func countCharacters(s, charset string) int {
+	if charset == CharsetNFKD {
+		// Combining marks split off by the decomposition are not letters, so "é" still counts once
+		s = norm.NFKD.String(s)
+	}
+	count := 0
+	for _, char := range s {
+		switch charset {
+		case CharsetUnicode, CharsetNFKD:
+			if isLetterOrDigit(char) {
+				count++
+			}
+		default:
+			if isAlphanumeric(string(char)) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// isLetterOrDigit reports whether a character is a letter or a decimal digit in any script.
+func isLetterOrDigit(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char)
+}
@@ -0,0 +1,84 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// Registry holds every known rule set by version, along with the active one used to score new receipts.
+// Older versions are kept so receipts scored under them can still be explained.
+type Registry struct {
+	active *RuleSet
+	sets   map[string]*RuleSet
+}
+
+// NewRegistry creates a registry with the given active rule set and any number of older ones.
+// A version may be given more than once, such as the built-in rules and a copy of them in an
+// archive, as long as every copy configures the same rules.
+func NewRegistry(active *RuleSet, others ...*RuleSet) (*Registry, error) {
+	r := &Registry{active: active, sets: make(map[string]*RuleSet)}
+	for _, rs := range append([]*RuleSet{active}, others...) {
+		if existing, ok := r.sets[rs.Version]; ok {
+			if !sameRules(existing, rs) {
+				return nil, fmt.Errorf("rule set version %q is configured twice with different rules", rs.Version)
+			}
+			continue
+		}
+		r.sets[rs.Version] = rs
+	}
+	return r, nil
+}
+
+// sameRules reports whether two rule sets configure the same rules. Their rules are compared in
+// their encoded form, so formatting and field order in the files they came from do not matter.
+func sameRules(a, b *RuleSet) bool {
+	if a == b {
+		return true
+	}
+	encodedA, errA := json.Marshal(a.Rules)
+	encodedB, errB := json.Marshal(b.Rules)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// LoadDir reads every *.json rule set file in a directory.
+func LoadDir(dir string) ([]*RuleSet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var sets []*RuleSet
+	for _, path := range paths {
+		rs, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, rs)
+	}
+	return sets, nil
+}
+
+// Active returns the rule set used to score new receipts.
+func (r *Registry) Active() *RuleSet {
+	return r.active
+}
+
+// Get returns the rule set with the given version.
+func (r *Registry) Get(version string) (*RuleSet, bool) {
+	rs, ok := r.sets[version]
+	return rs, ok
+}
+
+// Versions returns every known rule set version in sorted order.
+func (r *Registry) Versions() []string {
+	versions := make([]string, 0, len(r.sets))
+	for version := range r.sets {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
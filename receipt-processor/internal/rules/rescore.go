@@ -0,0 +1,64 @@
+package rules
+
+import (
+	"receipt-processor/internal/model"
+)
+
+// Delta is the change in points for one stored receipt when it is rescored.
+type Delta struct {
+	ID             string `json:"id"`
+	OldPoints      int    `json:"oldPoints"`
+	NewPoints      int    `json:"newPoints"`
+	Delta          int    `json:"delta"`
+	OldRuleVersion string `json:"oldRuleVersion"`
+}
+
+// RescoreReport summarizes a rescore of every stored receipt under one rule set.
+type RescoreReport struct {
+	RuleVersion string  `json:"ruleVersion"`
+	Committed   bool    `json:"committed"`
+	Receipts    int     `json:"receipts"`
+	Changed     int     `json:"changed"`
+	Deltas      []Delta `json:"deltas"`
+}
+
+// Rescore recomputes the points of every stored receipt with the given rule set and reports the
+// per-receipt deltas. When commit is true the new points and rule version are written back in a
+// single atomic PutAll; otherwise the store is left untouched.
+func Rescore(store model.ReceiptStore, rs *RuleSet, commit bool) (RescoreReport, error) {
+	records, err := store.List()
+	if err != nil {
+		return RescoreReport{}, err
+	}
+
+	report := RescoreReport{RuleVersion: rs.Version, Receipts: len(records), Deltas: []Delta{}}
+	var updated []model.Record
+	for _, record := range records {
+		points := rs.Tally(record.Receipt)
+		if points != record.Points {
+			report.Changed++
+		}
+		report.Deltas = append(report.Deltas, Delta{
+			ID:             record.ID,
+			OldPoints:      record.Points,
+			NewPoints:      points,
+			Delta:          points - record.Points,
+			OldRuleVersion: record.RuleVersion,
+		})
+
+		// Records already scored by this version are left alone
+		if points != record.Points || record.RuleVersion != rs.Version {
+			record.Points = points
+			record.RuleVersion = rs.Version
+			updated = append(updated, record)
+		}
+	}
+
+	if commit {
+		if err := store.PutAll(updated); err != nil {
+			return RescoreReport{}, err
+		}
+		report.Committed = true
+	}
+	return report, nil
+}
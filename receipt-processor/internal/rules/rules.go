@@ -0,0 +1,147 @@
+package rules
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"receipt-processor/internal/model"
+)
+
+// defaultConfig is the rule set that reproduces the original scoring behavior.
+//
+//go:embed default.json
+var defaultConfig []byte
+
+// Rule is a single parameterized scoring rule.
+type Rule interface {
+	// Apply scores a receipt and reports the points awarded and why.
+	Apply(receipt model.Receipt) Result
+	// Validate checks the rule's parameters after it is loaded from configuration.
+	Validate() error
+}
+
+// Result is the number of points a single scoring rule contributed to a receipt, and why.
+type Result struct {
+	Rule   string `json:"rule"`
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+}
+
+// RuleSet is an ordered list of scoring rules identified by a version.
+// Stored receipts record the version that scored them so historical points stay auditable.
+type RuleSet struct {
+	Version string
+	Rules   []Rule
+}
+
+// ruleConfig is the JSON form of a rule: a type discriminator plus the rule's own parameters.
+type ruleConfig struct {
+	Type string `json:"type"`
+}
+
+// ruleSetConfig is the JSON form of a rule set.
+type ruleSetConfig struct {
+	Version string            `json:"version"`
+	Rules   []json.RawMessage `json:"rules"`
+}
+
+// ruleTypes maps each configuration type name to a constructor for an empty rule of that type.
+var ruleTypes = map[string]func() Rule{
+	TypeRetailerAlphanumeric: func() Rule { return &RetailerAlphanumeric{} },
+	TypeTotalMultiple:        func() Rule { return &TotalMultiple{} },
+	TypeItemGroups:           func() Rule { return &ItemGroups{} },
+	TypeDescriptionLength:    func() Rule { return &DescriptionLength{} },
+	TypeOddDay:               func() Rule { return &OddDay{} },
+	TypeTimeWindow:           func() Rule { return &TimeWindow{} },
+	TypePointsPerDollar:      func() Rule { return &PointsPerDollar{} },
+}
+
+// Default returns the built-in rule set that matches the original scoring rules.
+func Default() *RuleSet {
+	rs, err := Parse(defaultConfig)
+	if err != nil {
+		panic(fmt.Sprintf("invalid default rule set: %v", err))
+	}
+	return rs
+}
+
+// Load reads a rule set from a JSON configuration file.
+func Load(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rule set: %w", err)
+	}
+	rs, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rs, nil
+}
+
+// Parse decodes and validates a rule set from JSON configuration.
+// When the configuration has no version, one is derived from a hash of its contents.
+func Parse(data []byte) (*RuleSet, error) {
+	var config ruleSetConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("decode rule set: %w", err)
+	}
+	if len(config.Rules) == 0 {
+		return nil, fmt.Errorf("rule set has no rules")
+	}
+
+	rs := &RuleSet{Version: config.Version}
+	if rs.Version == "" {
+		sum := sha256.Sum256(data)
+		rs.Version = "sha256-" + hex.EncodeToString(sum[:6])
+	}
+	for i, raw := range config.Rules {
+		var header ruleConfig
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		newRule, ok := ruleTypes[header.Type]
+		if !ok {
+			return nil, fmt.Errorf("rules[%d]: unknown rule type %q", i, header.Type)
+		}
+
+		rule := newRule()
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(rule); err != nil {
+			return nil, fmt.Errorf("rules[%d] (%s): %w", i, header.Type, err)
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("rules[%d] (%s): %w", i, header.Type, err)
+		}
+		rs.Rules = append(rs.Rules, rule)
+	}
+	return rs, nil
+}
+
+// Breakdown runs every rule against a receipt and reports the points each one contributed.
+// Rules that award nothing are still reported so the reason is visible.
+func (rs *RuleSet) Breakdown(receipt model.Receipt) []Result {
+	results := make([]Result, 0, len(rs.Rules))
+	for _, rule := range rs.Rules {
+		results = append(results, rule.Apply(receipt))
+	}
+	return results
+}
+
+// Tally computes the total points awarded for a receipt.
+func (rs *RuleSet) Tally(receipt model.Receipt) int {
+	return Total(rs.Breakdown(receipt))
+}
+
+// Total adds up the points of a breakdown.
+func Total(results []Result) int {
+	points := 0
+	for _, result := range results {
+		points += result.Points
+	}
+	return points
+}
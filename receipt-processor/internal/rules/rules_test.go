@@ -0,0 +1,308 @@
+package rules_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/rules"
+	"receipt-processor/internal/store"
+	"strings"
+	"testing"
+)
+
+// Testing function for loading a custom rule set from configuration
+func TestParseCustomRuleSet(t *testing.T) {
+	config := `{
+		"rules": [
+			{"type": "time_window", "name": "happy_hour", "after": "17:00", "before": "19:00", "points": 100},
+			{"type": "description_length", "divisor": 4, "priceMultiplier": "1.5"},
+			{"type": "item_groups", "groupSize": 3, "points": 7}
+		]
+	}`
+	ruleSet, err := rules.Parse([]byte(config))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "18:30",
+		Items: []model.Item{
+			{ShortDescription: "abcd", Price: model.MustParseMoney("2.01")},
+			{ShortDescription: "abc", Price: model.MustParseMoney("1.00")},
+			{ShortDescription: "abc", Price: model.MustParseMoney("1.00")},
+		},
+		Total: model.MustParseMoney("4.01"),
+	}
+
+	// happy_hour 100, ceil(2.01 * 1.5) = 4, one group of three items 7
+	if points := ruleSet.Tally(receipt); points != 111 {
+		t.Errorf("Expected 111 points, got %d", points)
+	}
+	breakdown := ruleSet.Breakdown(receipt)
+	if len(breakdown) != 3 || breakdown[0].Rule != "happy_hour" || breakdown[1].Rule != "description_length" {
+		t.Errorf("Unexpected breakdown %+v", breakdown)
+	}
+}
+
+// Testing function for rules that score the subtotal, tax, discount and tip lines
+func TestAmountRules(t *testing.T) {
+	config := `{
+		"rules": [
+			{"type": "points_per_dollar", "name": "pre_tax_dollars", "amount": "preTax", "points": 2},
+			{"type": "total_multiple", "name": "round_tip", "amount": "tip", "multiple": "1.00", "points": 15},
+			{"type": "total_multiple", "name": "round_total", "multiple": "1.00", "points": 50}
+		]
+	}`
+	ruleSet, err := rules.Parse([]byte(config))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tip := model.MustParseMoney("3.00")
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "18:30",
+		Items: []model.Item{
+			{ShortDescription: "abcd", Price: model.MustParseMoney("12.50")},
+		},
+		Taxes:     []model.Line{{Description: "Sales tax", Amount: model.MustParseMoney("0.84")}},
+		Discounts: []model.Line{{Description: "Coupon", Amount: model.MustParseMoney("2.00")}},
+		Tip:       &tip,
+		Total:     model.MustParseMoney("14.34"),
+	}
+
+	// 10 pre-tax dollars at 2 points, a round 3.00 tip 15, and a total of 14.34 is not round
+	if points := ruleSet.Tally(receipt); points != 35 {
+		t.Errorf("Expected 35 points, got %d: %+v", points, ruleSet.Breakdown(receipt))
+	}
+
+	// Without a tip the tip rule awards nothing rather than treating it as a round zero
+	receipt.Tip = nil
+	if breakdown := ruleSet.Breakdown(receipt); breakdown[1].Points != 0 || breakdown[1].Reason != "receipt has no tip" {
+		t.Errorf("Unexpected tip result %+v", breakdown[1])
+	}
+
+	// A negative amount is never a round multiple
+	negative, err := rules.Parse([]byte(`{"rules": [{"type": "total_multiple", "amount": "preTax", "multiple": "1.00", "points": 50}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	receipt.Discounts = []model.Line{{Description: "Coupon", Amount: model.MustParseMoney("15.50")}}
+	if points := negative.Tally(receipt); points != 0 {
+		t.Errorf("Expected no points for a pre-tax amount of -3.00, got %d: %+v", points, negative.Breakdown(receipt))
+	}
+}
+
+// Testing function for counting item groups by line or by unit
+func TestItemGroupsCount(t *testing.T) {
+	unitPrice := model.MustParseMoney("2.25")
+	receipt := model.Receipt{
+		Items: []model.Item{
+			{ShortDescription: "Gatorade", Price: model.MustParseMoney("6.75"), Quantity: 3, UnitPrice: &unitPrice},
+			{ShortDescription: "Pepsi", Price: model.MustParseMoney("1.25")},
+		},
+	}
+
+	for count, want := range map[string]int{"lines": 5, "units": 10, "": 5} {
+		ruleSet, err := rules.Parse([]byte(`{"rules": [{"type": "item_groups", "groupSize": 2, "points": 5, "count": "` + count + `"}]}`))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if points := ruleSet.Tally(receipt); points != want {
+			t.Errorf("Counting %q: expected %d points, got %d", count, want, points)
+		}
+	}
+}
+
+// Testing function for scaling the largest accepted price by the largest accepted multiplier
+func TestDescriptionLengthAtLimit(t *testing.T) {
+	receipt := model.Receipt{Items: []model.Item{{ShortDescription: "abc", Price: model.MaxMoney}}}
+
+	for multiplier, want := range map[string]int{"0.2": 2_000_000, "1000": 10_000_000_000, "999.999999": 9_999_999_990} {
+		ruleSet, err := rules.Parse([]byte(`{"rules": [{"type": "description_length", "divisor": 3, "priceMultiplier": "` + multiplier + `"}]}`))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if points := ruleSet.Tally(receipt); points != want {
+			t.Errorf("Multiplier %s: expected %d points, got %d", multiplier, want, points)
+		}
+	}
+}
+
+// Testing function for evaluating time rules in the receipt's local time or a configured zone
+func TestTimeZoneRules(t *testing.T) {
+	config := `{
+		"rules": [
+			{"type": "odd_day", "points": 6},
+			{"type": "odd_day", "name": "odd_day_utc", "timeZone": "UTC", "points": 6},
+			{"type": "time_window", "after": "22:00", "before": "23:59", "points": 10},
+			{"type": "time_window", "name": "window_chicago", "timeZone": "America/Chicago", "after": "02:00", "before": "04:00", "points": 10}
+		]
+	}`
+	ruleSet, err := rules.Parse([]byte(config))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// 11pm on the 1st in Honolulu is 9am on the 2nd in UTC and 3am on the 2nd in Chicago
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "23:00",
+		TimeZone:     "Pacific/Honolulu",
+	}
+	breakdown := ruleSet.Breakdown(receipt)
+	want := []int{6, 0, 10, 10}
+	for i, result := range breakdown {
+		if result.Points != want[i] {
+			t.Errorf("Expected %s to award %d points, got %+v", result.Rule, want[i], result)
+		}
+	}
+
+	if _, err := rules.Parse([]byte(`{"rules": [{"type": "odd_day", "timeZone": "Nowhere/Special", "points": 6}]}`)); err == nil || !strings.Contains(err.Error(), "invalid timeZone") {
+		t.Errorf("Expected an invalid timeZone error, got %v", err)
+	}
+}
+
+// Testing function for the retailer character classes
+func TestRetailerCharset(t *testing.T) {
+	testCases := []struct {
+		retailer             string
+		ascii, unicode, nfkd int
+	}{
+		{"Target", 6, 6, 6},
+		{"Café Müller", 8, 10, 10},
+		{"ローソン 100", 3, 7, 7},
+		{"Eﬃcient™ ①", 6, 7, 12},
+		{"トヨタ㍿", 0, 3, 7},
+		{"㌔マート", 0, 3, 5},
+		{"가나다", 0, 3, 6},
+	}
+
+	for _, tc := range testCases {
+		for charset, want := range map[string]int{"ascii": tc.ascii, "unicode": tc.unicode, "nfkd": tc.nfkd} {
+			ruleSet, err := rules.Parse([]byte(`{"rules": [{"type": "retailer_alphanumeric", "pointsPerCharacter": 1, "charset": "` + charset + `"}]}`))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if points := ruleSet.Tally(model.Receipt{Retailer: tc.retailer}); points != want {
+				t.Errorf("Expected %q to score %d points with %s, got %d", tc.retailer, want, charset, points)
+			}
+		}
+	}
+}
+
+// Testing function for rejecting invalid rule set configuration
+func TestParseInvalidRuleSet(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config string
+		errMsg string
+	}{
+		{"no rules", `{"rules": []}`, "no rules"},
+		{"unknown type", `{"rules": [{"type": "bogus"}]}`, "unknown rule type"},
+		{"unknown field", `{"rules": [{"type": "odd_day", "points": 6, "bonus": 1}]}`, "unknown field"},
+		{"bad window", `{"rules": [{"type": "time_window", "after": "16:00", "before": "14:00", "points": 1}]}`, "must be earlier"},
+		{"bad multiple", `{"rules": [{"type": "total_multiple", "multiple": "0.00", "points": 1}]}`, "multiple must be positive"},
+		{"bad multiplier", `{"rules": [{"type": "description_length", "divisor": 3, "priceMultiplier": "abc"}]}`, "invalid decimal"},
+		{"zero divisor", `{"rules": [{"type": "description_length", "divisor": 0, "priceMultiplier": "0.2"}]}`, "divisor must be positive"},
+		{"unknown amount", `{"rules": [{"type": "total_multiple", "amount": "change", "multiple": "1.00", "points": 1}]}`, "unknown amount"},
+		{"unknown charset", `{"rules": [{"type": "retailer_alphanumeric", "pointsPerCharacter": 1, "charset": "latin1"}]}`, "unknown charset"},
+		{"unknown count", `{"rules": [{"type": "item_groups", "groupSize": 2, "points": 5, "count": "pieces"}]}`, "unknown count"},
+		{"missing amount", `{"rules": [{"type": "points_per_dollar", "points": 1}]}`, "amount is required"},
+		{"multiplier too large", `{"rules": [{"type": "description_length", "divisor": 3, "priceMultiplier": "1000.000001"}]}`, "at most 1000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := rules.Parse([]byte(tc.config))
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("Expected error containing %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+// Testing function for rescoring stored receipts with a dry run and a commit
+func TestRescore(t *testing.T) {
+	receiptStore := store.NewMemoryStore()
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "18:30",
+		Items:        []model.Item{{ShortDescription: "abc", Price: model.MustParseMoney("1.00")}},
+		Total:        model.MustParseMoney("1.00"),
+	}
+	receiptStore.Put(model.Record{ID: "a", Receipt: receipt, Points: 10, RuleVersion: "old"})
+
+	doubled, err := rules.Parse([]byte(`{"version": "double", "rules": [{"type": "retailer_alphanumeric", "pointsPerCharacter": 2}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	report, err := rules.Rescore(receiptStore, doubled, false)
+	if err != nil {
+		t.Fatalf("Rescore failed: %v", err)
+	}
+	if report.Committed || report.Changed != 1 || len(report.Deltas) != 1 || report.Deltas[0].Delta != 2 {
+		t.Errorf("Unexpected dry run report %+v", report)
+	}
+	if points, _ := receiptStore.GetPoints("a"); points != 10 {
+		t.Errorf("Expected dry run to leave 10 points, got %d", points)
+	}
+
+	report, err = rules.Rescore(receiptStore, doubled, true)
+	if err != nil {
+		t.Fatalf("Rescore failed: %v", err)
+	}
+	record, _ := receiptStore.Get("a")
+	if !report.Committed || record.Points != 12 || record.RuleVersion != "double" {
+		t.Errorf("Expected committed rescore to store 12 points from version double, got %+v", record)
+	}
+}
+
+// Testing function for archives holding a copy of a loaded rule set version
+func TestRegistryDuplicateVersions(t *testing.T) {
+	builtin, err := os.ReadFile("default.json")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	// A copy laid out differently is still the same rule set
+	var copied bytes.Buffer
+	json.Compact(&copied, builtin)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "default.json"), copied.Bytes(), 0o644)
+
+	archived, err := rules.LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+	active, err := rules.Parse([]byte(`{"version": "promo-1", "rules": [{"type": "odd_day", "points": 6}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	registry, err := rules.NewRegistry(active, append([]*rules.RuleSet{rules.Default()}, archived...)...)
+	if err != nil {
+		t.Fatalf("Expected a copy of the built-in rules to be accepted, got %v", err)
+	}
+	if got := strings.Join(registry.Versions(), ","); got != "default-1,promo-1" {
+		t.Errorf("Versions() = %q, want default-1,promo-1", got)
+	}
+
+	changed := bytes.Replace(copied.Bytes(), []byte(`"points":50`), []byte(`"points":75`), 1)
+	if bytes.Equal(changed, copied.Bytes()) {
+		t.Fatalf("Expected to change the copied rules")
+	}
+	different, err := rules.Parse(changed)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := rules.NewRegistry(active, rules.Default(), different); err == nil {
+		t.Errorf("Expected an error for one version configured with different rules")
+	}
+}
@@ -0,0 +1,393 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/model"
+	"sync"
+)
+
+const (
+	walFileName      = "receipts.wal"
+	snapshotFileName = "receipts.snapshot"
+
+	// DefaultSnapshotEvery is the number of log entries written before the log is compacted into a snapshot.
+	DefaultSnapshotEvery = 1000
+)
+
+// walEntry is a single line of the write-ahead log.
+type walEntry struct {
+	Op      string         `json:"op"`
+	Record  *model.Record  `json:"record,omitempty"`
+	Records []model.Record `json:"records,omitempty"`
+	ID      string         `json:"id,omitempty"`
+}
+
+const (
+	opPut    = "put"
+	opPutAll = "putAll"
+	opDelete = "delete"
+)
+
+// errClosed is returned by writes to a FileStore after Close.
+var errClosed = errors.New("file store is closed")
+
+// errFailed is returned by writes to a FileStore whose log could not be repaired after a failed write.
+var errFailed = errors.New("file store failed")
+
+// snapshot is the on-disk format of a compacted store.
+type snapshot struct {
+	Records []model.Record `json:"records"`
+}
+
+// FileStore is a durable receipt store. Every change is appended to a write-ahead log and
+// synced before it is applied in memory. Once the log reaches SnapshotEvery entries it is
+// compacted into a snapshot file. Opening a FileStore replays the snapshot and then the log.
+type FileStore struct {
+	// SnapshotEvery is the number of log entries that triggers a compaction. Zero disables it.
+	SnapshotEvery int
+
+	mu         sync.Mutex // Serializes writes to the log
+	dir        string
+	wal        *os.File
+	walEntries int
+	failed     error // set when a failed write could not be rolled back; later writes are refused
+	mem        *MemoryStore
+}
+
+// OpenFileStore opens or creates a file-backed store in dir and replays any existing data.
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create store directory: %w", err)
+	}
+
+	s := &FileStore{
+		SnapshotEvery: DefaultSnapshotEvery,
+		dir:           dir,
+		mem:           NewMemoryStore(),
+	}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open write-ahead log: %w", err)
+	}
+	s.wal = wal
+	if err := s.replayWAL(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadSnapshot reads the snapshot file into memory if one exists.
+func (s *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	for _, record := range snap.Records {
+		s.mem.Put(record)
+	}
+	return nil
+}
+
+// replayWAL applies every complete log entry on top of the snapshot. A torn final line left
+// by a crash mid-write is discarded and truncated away so later appends start cleanly.
+func (s *FileStore) replayWAL() error {
+	reader := bufio.NewReader(s.wal)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read write-ahead log: %w", err)
+		}
+
+		var entry walEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return fmt.Errorf("decode write-ahead log entry at offset %d: %w", offset, err)
+		}
+		s.apply(entry)
+		offset += int64(len(line))
+		s.walEntries++
+	}
+
+	if err := s.wal.Truncate(offset); err != nil {
+		return fmt.Errorf("truncate write-ahead log: %w", err)
+	}
+	if _, err := s.wal.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// apply performs a log entry against the in-memory state.
+func (s *FileStore) apply(entry walEntry) {
+	switch entry.Op {
+	case opPut:
+		if entry.Record != nil {
+			s.mem.Put(*entry.Record)
+		}
+	case opPutAll:
+		s.mem.PutAll(entry.Records)
+	case opDelete:
+		s.mem.Delete(entry.ID)
+	}
+}
+
+// append writes an entry to the log, syncs it to disk and then applies it in memory.
+// If check is given it runs under the write lock first, and its error aborts the write.
+func (s *FileStore) append(entry walEntry, check func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return errClosed
+	}
+	if s.failed != nil {
+		return s.failed
+	}
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode write-ahead log entry: %w", err)
+	}
+	offset, err := s.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("seek write-ahead log: %w", err)
+	}
+	if _, err := s.wal.Write(append(line, '\n')); err != nil {
+		s.rollback(offset)
+		return fmt.Errorf("write write-ahead log: %w", err)
+	}
+	if err := s.wal.Sync(); err != nil {
+		s.rollback(offset)
+		return fmt.Errorf("sync write-ahead log: %w", err)
+	}
+	s.apply(entry)
+	s.walEntries++
+
+	// The entry is durable now, so a failed compaction must not fail the write. The log keeps
+	// every entry and stays over the threshold, so the next write tries again.
+	if s.SnapshotEvery > 0 && s.walEntries >= s.SnapshotEvery {
+		if err := s.compact(); err != nil {
+			log.Printf("Compacting receipt store failed, will retry on the next write: %v", err)
+		}
+	}
+	return nil
+}
+
+// rollback cuts the log back to offset after a failed write, so the next entry is not appended
+// to a partial line that would make the log unreadable. If that fails too, the store is marked
+// failed so it refuses writes and fails pings. The caller must hold s.mu.
+func (s *FileStore) rollback(offset int64) {
+	err := s.wal.Truncate(offset)
+	if err == nil {
+		_, err = s.wal.Seek(offset, io.SeekStart)
+	}
+	if err == nil {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		s.failed = fmt.Errorf("%w: repair write-ahead log after a failed write: %v", errFailed, err)
+		log.Printf("Receipt store refuses further writes: %v", s.failed)
+	}
+}
+
+// syncDir syncs a directory so renames within it survive a power loss.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// compact writes the current state to a new snapshot and empties the log.
+// The snapshot is written to a temporary file and renamed so a crash never leaves a partial snapshot.
+// The caller must hold s.mu.
+func (s *FileStore) compact() error {
+	records, _ := s.mem.List()
+	data, err := json.Marshal(snapshot{Records: records})
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	tmpPath := filepath.Join(s.dir, snapshotFileName+".tmp")
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("install snapshot: %w", err)
+	}
+	// The rename must reach the disk before the log is emptied, or a power loss could keep the
+	// empty log and the old snapshot, losing every record since
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("sync store directory: %w", err)
+	}
+
+	// Replaying the log over the new snapshot is harmless, so a crash before this point only costs time
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate write-ahead log: %w", err)
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek write-ahead log: %w", err)
+	}
+	s.walEntries = 0
+	// The snapshot holds every applied entry and the log is empty, so nothing is left to repair
+	s.failed = nil
+	return nil
+}
+
+// Snapshot compacts the write-ahead log into a snapshot immediately.
+func (s *FileStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return errClosed
+	}
+	return s.compact()
+}
+
+// Close compacts the log and releases the underlying files.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	err := s.compact()
+	if closeErr := s.wal.Close(); err == nil {
+		err = closeErr
+	}
+	s.wal = nil
+	return err
+}
+
+// Create durably saves a new record, failing if its ID is already taken.
+func (s *FileStore) Create(record model.Record) error {
+	return s.append(walEntry{Op: opPut, Record: &record}, func() error {
+		if _, ok := s.mem.Get(record.ID); ok {
+			return model.ErrIDExists
+		}
+		return nil
+	})
+}
+
+// Put durably saves a record under its ID.
+func (s *FileStore) Put(record model.Record) error {
+	return s.append(walEntry{Op: opPut, Record: &record}, nil)
+}
+
+// PutAll durably saves several records. They share one log entry, so a crash
+// mid-write loses all of them rather than leaving some applied.
+func (s *FileStore) PutAll(records []model.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return s.append(walEntry{Op: opPutAll, Records: records}, nil)
+}
+
+// Ping reports an error once the store is closed, or failed after a write it could not roll back.
+func (s *FileStore) Ping() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return errClosed
+	}
+	return s.failed
+}
+
+// LogEntries returns the number of entries written to the log since the last snapshot.
+func (s *FileStore) LogEntries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.walEntries
+}
+
+// Len returns the number of stored records.
+func (s *FileStore) Len() int {
+	return s.mem.Len()
+}
+
+// Get retrieves the full record for an ID.
+func (s *FileStore) Get(id string) (model.Record, bool) {
+	return s.mem.Get(id)
+}
+
+// FindByFingerprint retrieves the earliest record with a content fingerprint.
+func (s *FileStore) FindByFingerprint(fingerprint string) (model.Record, bool) {
+	return s.mem.FindByFingerprint(fingerprint)
+}
+
+// GetReceipt retrieves the receipt for an ID.
+func (s *FileStore) GetReceipt(id string) (model.Receipt, bool) {
+	return s.mem.GetReceipt(id)
+}
+
+// GetPoints retrieves points for a receipt ID.
+func (s *FileStore) GetPoints(id string) (int, bool) {
+	return s.mem.GetPoints(id)
+}
+
+// List returns every stored record ordered by ID.
+func (s *FileStore) List() ([]model.Record, error) {
+	return s.mem.List()
+}
+
+// Query returns one page of records matching the query, ordered by ID.
+func (s *FileStore) Query(query model.Query) (model.Page, error) {
+	return s.mem.Query(query)
+}
+
+// Delete durably removes the record for an ID and reports whether it existed.
+func (s *FileStore) Delete(id string) (bool, error) {
+	if _, ok := s.mem.GetReceipt(id); !ok {
+		return false, nil
+	}
+	if err := s.append(walEntry{Op: opDelete, ID: id}, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,168 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/store"
+	"receipt-processor/internal/validate"
+	"testing"
+)
+
+// Testing function for replaying the write-ahead log and snapshot after a restart
+func TestFileStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := store.OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	s.SnapshotEvery = 3
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := s.Put(model.Record{ID: id, Receipt: model.Receipt{Retailer: "Target"}, Points: len(id)}); err != nil {
+			t.Fatalf("Put(%s) failed: %v", id, err)
+		}
+	}
+	if _, err := s.Delete("b"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := s.PutAll([]model.Record{{ID: "c", Points: 30}, {ID: "d", Points: 40}}); err != nil {
+		t.Fatalf("PutAll failed: %v", err)
+	}
+
+	// Simulate a crash: the log is left behind without a final compaction, including a torn last line
+	wal, err := os.OpenFile(filepath.Join(dir, "receipts.wal"), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	wal.WriteString(`{"op":"put","record":{"id":"torn"`)
+	wal.Close()
+
+	reopened, err := store.OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopening store failed: %v", err)
+	}
+	defer reopened.Close()
+
+	records, err := reopened.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	if len(ids) != 3 || ids[0] != "a" || ids[1] != "c" || ids[2] != "d" {
+		t.Errorf("Expected records a, c, d after replay, got %v", ids)
+	}
+
+	receipt, ok := reopened.GetReceipt("a")
+	if !ok || receipt.Retailer != "Target" {
+		t.Errorf("Expected receipt a to survive restart, got %+v (found %v)", receipt, ok)
+	}
+	if points, _ := reopened.GetPoints("d"); points != 40 {
+		t.Errorf("Expected PutAll to leave 40 points on d, got %d", points)
+	}
+
+	// The torn line must be dropped so new appends are readable
+	if err := reopened.Put(model.Record{ID: "e", Points: 1}); err != nil {
+		t.Fatalf("Put after replay failed: %v", err)
+	}
+	if n := reopened.Len(); n != 4 {
+		t.Errorf("Expected 4 records, got %d", n)
+	}
+	if n := reopened.LogEntries(); n != 1 {
+		t.Errorf("Expected 1 log entry since the snapshot, got %d", n)
+	}
+	if err := reopened.Ping(); err != nil {
+		t.Errorf("Expected an open store to ping, got %v", err)
+	}
+	reopened.Close()
+	if reopened.Ping() == nil || reopened.Put(model.Record{ID: "f"}) == nil {
+		t.Errorf("Expected a closed store to fail pings and writes")
+	}
+
+	again, err := store.OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopening store after compaction failed: %v", err)
+	}
+	defer again.Close()
+	if points, ok := again.GetPoints("e"); !ok || points != 1 {
+		t.Errorf("Expected record e with 1 point, got %d (found %v)", points, ok)
+	}
+}
+
+// Testing function for writes succeeding when compaction fails, and compaction being retried
+func TestFileStoreCompactionFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	defer s.Close()
+	s.SnapshotEvery = 2
+
+	// A directory where the temporary snapshot goes makes compaction fail
+	blocker := filepath.Join(dir, "receipts.snapshot.tmp")
+	if err := os.Mkdir(blocker, 0o755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := s.Create(model.Record{ID: id, Points: 1}); err != nil {
+			t.Fatalf("Create(%s) failed although the log entry was durable: %v", id, err)
+		}
+	}
+	if n := s.LogEntries(); n != 3 {
+		t.Errorf("Expected the log to keep all 3 entries, got %d", n)
+	}
+
+	os.Remove(blocker)
+	if err := s.Create(model.Record{ID: "d", Points: 1}); err != nil {
+		t.Fatalf("Create(d) failed: %v", err)
+	}
+	if n := s.LogEntries(); n != 0 {
+		t.Errorf("Expected the next write to compact the log, got %d entries", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "receipts.snapshot")); err != nil {
+		t.Errorf("Expected a snapshot after the retry: %v", err)
+	}
+}
+
+// Testing function for reopening a store holding a receipt annotated with a total below its items
+func TestFileStoreNegativeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+
+	receipt := model.Receipt{
+		Retailer: "Target",
+		Items:    []model.Item{{ShortDescription: "Gift card", Price: model.MustParseMoney("50.00")}},
+		Total:    model.MustParseMoney("1.00"),
+	}
+	mismatch := validate.Reconcile(receipt, validate.Tolerance{})
+	if mismatch == nil || mismatch.Difference != -4900 {
+		t.Fatalf("Expected a difference of -49.00, got %+v", mismatch)
+	}
+	if err := s.Create(model.Record{ID: "a", Receipt: receipt, TotalMismatch: mismatch}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	check := func(when string) {
+		reopened, err := store.OpenFileStore(dir)
+		if err != nil {
+			t.Fatalf("Reopening store %s failed: %v", when, err)
+		}
+		defer reopened.Close()
+		record, ok := reopened.Get("a")
+		if !ok || record.TotalMismatch == nil || *record.TotalMismatch != *mismatch {
+			t.Errorf("Expected the mismatch %+v to survive reopening %s, got %+v", mismatch, when, record.TotalMismatch)
+		}
+	}
+	// The record is first read back from the log, then from the snapshot written on close
+	check("from the log")
+	s.Close()
+	check("from the snapshot")
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"receipt-processor/internal/model"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps receipts in an in-memory map. Everything is lost when the process exits.
+// A sorted index of IDs lets listing and cursor pagination start at any position without sorting the map,
+// and a fingerprint index finds the original of a duplicate receipt.
+type MemoryStore struct {
+	mu           sync.RWMutex // Mutex for locking access to the map and indexes
+	records      map[string]model.Record
+	ids          []string          // sorted
+	fingerprints map[string]string // fingerprint to the ID of the earliest record with it
+}
+
+// NewMemoryStore creates an empty in-memory receipt store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records:      make(map[string]model.Record),
+		fingerprints: make(map[string]string),
+	}
+}
+
+// put saves a record and indexes its ID. The caller must hold s.mu.
+func (s *MemoryStore) put(record model.Record) {
+	if _, ok := s.records[record.ID]; !ok {
+		i := sort.SearchStrings(s.ids, record.ID)
+		s.ids = append(s.ids, "")
+		copy(s.ids[i+1:], s.ids[i:])
+		s.ids[i] = record.ID
+	}
+	s.records[record.ID] = record
+
+	if record.Fingerprint != "" {
+		if original, ok := s.fingerprints[record.Fingerprint]; !ok || record.CreatedAt.Before(s.records[original].CreatedAt) {
+			s.fingerprints[record.Fingerprint] = record.ID
+		}
+	}
+}
+
+// Create saves a new record, failing if its ID is already taken.
+func (s *MemoryStore) Create(record model.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[record.ID]; ok {
+		return model.ErrIDExists
+	}
+	s.put(record)
+	return nil
+}
+
+// Put saves a record under its ID.
+func (s *MemoryStore) Put(record model.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.put(record)
+	return nil
+}
+
+// PutAll saves several records under a single lock so readers never see a partial update.
+func (s *MemoryStore) PutAll(records []model.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		s.put(record)
+	}
+	return nil
+}
+
+// Get retrieves the full record for an ID.
+func (s *MemoryStore) Get(id string) (model.Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	return record, ok
+}
+
+// FindByFingerprint retrieves the earliest record with a content fingerprint.
+func (s *MemoryStore) FindByFingerprint(fingerprint string) (model.Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.fingerprints[fingerprint]
+	if !ok {
+		return model.Record{}, false
+	}
+	return s.records[id], true
+}
+
+// GetReceipt retrieves the receipt for an ID.
+func (s *MemoryStore) GetReceipt(id string) (model.Receipt, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	return record.Receipt, ok
+}
+
+// GetPoints retrieves points for a receipt ID.
+func (s *MemoryStore) GetPoints(id string) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	return record.Points, ok
+}
+
+// List returns every stored record ordered by ID.
+func (s *MemoryStore) List() ([]model.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]model.Record, 0, len(s.ids))
+	for _, id := range s.ids {
+		records = append(records, s.records[id])
+	}
+	return records, nil
+}
+
+// Query returns one page of records matching the query, starting after the query's cursor ID.
+func (s *MemoryStore) Query(query model.Query) (model.Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Skip straight to the first ID after the cursor
+	start := 0
+	if query.After != "" {
+		start = sort.Search(len(s.ids), func(i int) bool { return s.ids[i] > query.After })
+	}
+
+	page := model.Page{Records: []model.Record{}}
+	for _, id := range s.ids[start:] {
+		record := s.records[id]
+		if !query.Matches(record) {
+			continue
+		}
+		if query.Limit > 0 && len(page.Records) == query.Limit {
+			page.NextCursor = model.EncodeCursor(page.Records[len(page.Records)-1].ID)
+			break
+		}
+		page.Records = append(page.Records, record)
+	}
+	return page, nil
+}
+
+// Delete removes the record for an ID and reports whether it existed.
+func (s *MemoryStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return false, nil
+	}
+	delete(s.records, id)
+	if s.fingerprints[record.Fingerprint] == id {
+		delete(s.fingerprints, record.Fingerprint)
+	}
+	i := sort.SearchStrings(s.ids, id)
+	s.ids = append(s.ids[:i], s.ids[i+1:]...)
+	return true, nil
+}
+
+// Len returns the number of stored records.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+// Ping always succeeds: a memory store is usable for as long as the process runs.
+func (s *MemoryStore) Ping() error {
+	return nil
+}
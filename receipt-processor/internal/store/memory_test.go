@@ -0,0 +1,55 @@
+package store_test
+
+import (
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/store"
+	"testing"
+)
+
+// Testing function for the put, get, list and delete cycle of the in-memory store
+func TestMemoryStore(t *testing.T) {
+	s := store.NewMemoryStore()
+
+	records := []model.Record{
+		{ID: "b", Receipt: model.Receipt{Retailer: "Target"}, Points: 10},
+		{ID: "a", Receipt: model.Receipt{Retailer: "Walmart"}, Points: 20},
+	}
+	for _, record := range records {
+		if err := s.Put(record); err != nil {
+			t.Fatalf("Put(%s) failed: %v", record.ID, err)
+		}
+	}
+
+	receipt, ok := s.GetReceipt("a")
+	if !ok || receipt.Retailer != "Walmart" {
+		t.Errorf("Expected receipt for Walmart, got %+v (found %v)", receipt, ok)
+	}
+
+	points, ok := s.GetPoints("b")
+	if !ok || points != 10 {
+		t.Errorf("Expected 10 points, got %d (found %v)", points, ok)
+	}
+
+	listed, err := s.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(listed) != 2 || listed[0].ID != "a" || listed[1].ID != "b" {
+		t.Errorf("Expected records ordered a, b, got %+v", listed)
+	}
+	if n := s.Len(); n != 2 {
+		t.Errorf("Expected 2 records, got %d", n)
+	}
+
+	deleted, err := s.Delete("a")
+	if err != nil || !deleted {
+		t.Errorf("Expected Delete(a) to succeed, got %v, %v", deleted, err)
+	}
+	if _, ok := s.GetPoints("a"); ok {
+		t.Errorf("Expected record a to be gone after Delete")
+	}
+	deleted, _ = s.Delete("a")
+	if deleted {
+		t.Errorf("Expected second Delete(a) to report false")
+	}
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/model"
+	"testing"
+)
+
+// Testing function for cutting a partial entry off the log after a failed write
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Put(model.Record{ID: "a", Points: 1}); err != nil {
+		t.Fatalf("Put(a) failed: %v", err)
+	}
+	info, _ := s.wal.Stat()
+	offset := info.Size()
+
+	// A short write leaves part of an entry behind, which the rollback must remove
+	s.mu.Lock()
+	s.wal.Write([]byte(`{"op":"put","record":{"id":"torn"`))
+	s.rollback(offset)
+	s.mu.Unlock()
+	if err := s.Put(model.Record{ID: "b", Points: 2}); err != nil {
+		t.Fatalf("Put(b) failed: %v", err)
+	}
+	s.wal.Sync()
+	reopened, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopening store after a rolled back write failed: %v", err)
+	}
+	if n := reopened.Len(); n != 2 {
+		t.Errorf("Expected records a and b after reopening, got %d records", n)
+	}
+	reopened.Close()
+}
+
+// Testing function for refusing writes once a failed write cannot be rolled back
+func TestRollbackFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	defer s.Close()
+
+	// A read-only handle fails the write and the truncation after it
+	readOnly, err := os.Open(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	writable := s.wal
+	s.wal = readOnly
+	if err := s.Put(model.Record{ID: "a"}); err == nil {
+		t.Fatalf("Expected the write to fail")
+	}
+	if err := s.Ping(); err == nil {
+		t.Errorf("Expected a failed store to fail pings")
+	}
+	s.wal = writable
+	readOnly.Close()
+	if err := s.Put(model.Record{ID: "b"}); err == nil {
+		t.Errorf("Expected a failed store to refuse writes")
+	}
+
+	// A snapshot holds every applied record and empties the log, which repairs the store
+	if err := s.Snapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if err := s.Ping(); err != nil {
+		t.Errorf("Expected the store to recover after a snapshot, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"receipt-processor/internal/model"
+	"strconv"
+)
+
+// wireReceipt mirrors model.Receipt with prices left undecoded, so every malformed price can be
+// reported with its own field path instead of failing the whole document at the first one.
+type wireReceipt struct {
+	Retailer     string          `json:"retailer"`
+	PurchaseDate string          `json:"purchaseDate"`
+	PurchaseTime string          `json:"purchaseTime"`
+	TimeZone     string          `json:"timeZone"`
+	Items        []wireItem      `json:"items"`
+	Subtotal     json.RawMessage `json:"subtotal"`
+	Taxes        []wireLine      `json:"taxes"`
+	Discounts    []wireLine      `json:"discounts"`
+	Tip          json.RawMessage `json:"tip"`
+	Total        json.RawMessage `json:"total"`
+}
+
+type wireItem struct {
+	ShortDescription string          `json:"shortDescription"`
+	Price            json.RawMessage `json:"price"`
+	Quantity         json.RawMessage `json:"quantity"`
+	UnitPrice        json.RawMessage `json:"unitPrice"`
+}
+
+type wireLine struct {
+	Description string          `json:"description"`
+	Amount      json.RawMessage `json:"amount"`
+}
+
+// Decode reads a JSON receipt, fills in its time zone from zones when it has none, and validates it.
+// The error is non-nil only when the input is not a JSON receipt document at all; otherwise every
+// invalid field, including prices that could not be parsed, is returned in the field errors.
+func Decode(r io.Reader, zones model.Zones) (model.Receipt, []FieldError, error) {
+	var wire wireReceipt
+	if err := json.NewDecoder(r).Decode(&wire); err != nil {
+		return model.Receipt{}, nil, err
+	}
+
+	receipt, errs := wire.toReceipt()
+	zones.Apply(&receipt)
+	skip := make(map[string]bool)
+	for _, err := range errs {
+		skip[err.Field] = true
+	}
+	errs = append(errs, validate(receipt, skip)...)
+	Sort(errs)
+	return receipt, errs, nil
+}
+
+// decodePrice parses a raw JSON price, reporting a missing or malformed value against field.
+func decodePrice(raw json.RawMessage, field string) (model.Money, *FieldError) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, &FieldError{field, FieldMissing, fmt.Sprintf("%s is required", field)}
+	}
+	var price model.Money
+	if err := json.Unmarshal(raw, &price); errors.Is(err, model.ErrMoneyOutOfRange) {
+		return 0, &FieldError{field, FieldInvalidValue, fmt.Sprintf("%s must be at most %s", field, model.MaxMoney)}
+	} else if err != nil {
+		return 0, &FieldError{field, FieldInvalidPrice, fmt.Sprintf("%s must be a dollar amount such as \"6.49\"", field)}
+	}
+	return price, nil
+}
+
+// decodeOptionalPrice parses a raw JSON price that may be left out, returning nil when it is.
+func decodeOptionalPrice(raw json.RawMessage, field string) (*model.Money, *FieldError) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	price, err := decodePrice(raw, field)
+	if err != nil {
+		return nil, err
+	}
+	return &price, nil
+}
+
+// decodeQuantity parses an optional raw JSON item quantity, which must be a whole number from 1 to MaxQuantity.
+func decodeQuantity(raw json.RawMessage, field string) (int, *FieldError) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	quantity, err := strconv.Atoi(string(raw))
+	if err != nil || quantity < 1 || quantity > model.MaxQuantity {
+		return 0, &FieldError{field, FieldInvalidValue, fmt.Sprintf("%s must be a whole number from 1 to %d", field, model.MaxQuantity)}
+	}
+	return quantity, nil
+}
+
+// toLines converts tax or discount lines, collecting every amount that cannot be parsed.
+func toLines(wire []wireLine, name string) ([]model.Line, []FieldError) {
+	var lines []model.Line
+	var errs []FieldError
+	for i, line := range wire {
+		amount, err := decodePrice(line.Amount, fmt.Sprintf("%s[%d].amount", name, i))
+		if err != nil {
+			errs = append(errs, *err)
+		}
+		lines = append(lines, model.Line{Description: line.Description, Amount: amount})
+	}
+	return lines, errs
+}
+
+// toReceipt converts the wire form into a model.Receipt, collecting every amount that cannot be parsed.
+func (wr wireReceipt) toReceipt() (model.Receipt, []FieldError) {
+	var errs []FieldError
+	receipt := model.Receipt{
+		Retailer:     wr.Retailer,
+		PurchaseDate: wr.PurchaseDate,
+		PurchaseTime: wr.PurchaseTime,
+		TimeZone:     wr.TimeZone,
+	}
+	for i, item := range wr.Items {
+		price, err := decodePrice(item.Price, fmt.Sprintf("items[%d].price", i))
+		if err != nil {
+			errs = append(errs, *err)
+		}
+		quantity, err := decodeQuantity(item.Quantity, fmt.Sprintf("items[%d].quantity", i))
+		if err != nil {
+			errs = append(errs, *err)
+		}
+		unitPrice, err := decodeOptionalPrice(item.UnitPrice, fmt.Sprintf("items[%d].unitPrice", i))
+		if err != nil {
+			errs = append(errs, *err)
+		}
+		receipt.Items = append(receipt.Items, model.Item{ShortDescription: item.ShortDescription, Price: price, Quantity: quantity, UnitPrice: unitPrice})
+	}
+
+	var lineErrs []FieldError
+	receipt.Taxes, lineErrs = toLines(wr.Taxes, "taxes")
+	errs = append(errs, lineErrs...)
+	receipt.Discounts, lineErrs = toLines(wr.Discounts, "discounts")
+	errs = append(errs, lineErrs...)
+
+	var err *FieldError
+	if receipt.Subtotal, err = decodeOptionalPrice(wr.Subtotal, "subtotal"); err != nil {
+		errs = append(errs, *err)
+	}
+	if receipt.Tip, err = decodeOptionalPrice(wr.Tip, "tip"); err != nil {
+		errs = append(errs, *err)
+	}
+	if receipt.Total, err = decodePrice(wr.Total, "total"); err != nil {
+		errs = append(errs, *err)
+	}
+	return receipt, errs
+}
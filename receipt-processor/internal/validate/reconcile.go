@@ -0,0 +1,92 @@
+package validate
+
+import (
+	"fmt"
+	"receipt-processor/internal/model"
+	"regexp"
+	"strconv"
+)
+
+// Tolerance is how far a receipt total may be from the sum of its item prices before the two are
+// considered not to reconcile, to leave room for tax. It is either a fixed amount or a percentage
+// of the items sum.
+type Tolerance struct {
+	Amount      model.Money
+	BasisPoints int64 // hundredths of a percent of the items sum
+}
+
+// validPercent matches a percentage with up to two decimal places, such as "15%" or "7.25%".
+var validPercent = regexp.MustCompile(`^(\d{1,4})(?:\.(\d{1,2}))?%$`)
+
+// ParseTolerance parses a tolerance written as a dollar amount such as "2.00" or a percentage such as "15%"
+// of at most 100%.
+func ParseTolerance(value string) (Tolerance, error) {
+	if match := validPercent.FindStringSubmatch(value); match != nil {
+		whole, _ := strconv.ParseInt(match[1], 10, 64)
+		fraction := match[2]
+		for len(fraction) < 2 {
+			fraction += "0"
+		}
+		hundredths, _ := strconv.ParseInt(fraction, 10, 64)
+		if basisPoints := whole*100 + hundredths; basisPoints <= 100_00 {
+			return Tolerance{BasisPoints: basisPoints}, nil
+		}
+		return Tolerance{}, fmt.Errorf("invalid tolerance %q: a percentage must be at most 100%%", value)
+	}
+	amount, err := model.ParseMoney(value)
+	if err != nil {
+		return Tolerance{}, fmt.Errorf("invalid tolerance %q: must be an amount such as \"2.00\" or a percentage such as \"15%%\"", value)
+	}
+	return Tolerance{Amount: amount}, nil
+}
+
+// Allowed returns the largest difference the tolerance accepts for an items sum, rounded up to the cent.
+func (t Tolerance) Allowed(itemsTotal model.Money) model.Money {
+	allowed := t.Amount
+	if t.BasisPoints > 0 && itemsTotal > 0 {
+		allowed += model.Money((itemsTotal.Cents()*t.BasisPoints + 9999) / 10000)
+	}
+	return allowed
+}
+
+// String formats the tolerance the way ParseTolerance reads it.
+func (t Tolerance) String() string {
+	if t.BasisPoints > 0 {
+		if t.BasisPoints%100 == 0 {
+			return fmt.Sprintf("%d%%", t.BasisPoints/100)
+		}
+		return fmt.Sprintf("%d.%02d%%", t.BasisPoints/100, t.BasisPoints%100)
+	}
+	return t.Amount.String()
+}
+
+// Reconcile compares a receipt's total with the sum of its item prices. It returns nil when they
+// are within the tolerance in either direction, and the details of the mismatch otherwise.
+// Receipts that itemize tax, discounts or tip always reconcile, since Validate already
+// requires their total to add up exactly.
+func Reconcile(receipt model.Receipt, tolerance Tolerance) *model.TotalMismatch {
+	if receipt.HasLines() {
+		return nil
+	}
+
+	itemsTotal := receipt.ItemsTotal()
+	difference := receipt.Total - itemsTotal
+	allowed := tolerance.Allowed(itemsTotal)
+	if difference <= allowed && -difference <= allowed {
+		return nil
+	}
+	return &model.TotalMismatch{
+		ItemsTotal: model.SignedMoney(itemsTotal),
+		Difference: model.SignedMoney(difference),
+		Allowed:    model.SignedMoney(allowed),
+	}
+}
+
+// MismatchError describes a total that does not reconcile as a field error on the total.
+func MismatchError(mismatch *model.TotalMismatch) FieldError {
+	return FieldError{
+		Field:   "total",
+		Code:    FieldTotalMismatch,
+		Message: fmt.Sprintf("total differs from the items sum of %s by %s, more than the allowed %s", mismatch.ItemsTotal, mismatch.Difference, mismatch.Allowed),
+	}
+}
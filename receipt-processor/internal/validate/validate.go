@@ -0,0 +1,267 @@
+package validate
+
+import (
+	"fmt"
+	"receipt-processor/internal/model"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stable error codes for individual fields
+const (
+	FieldMissing           = "missing_field"
+	FieldInvalidDateFormat = "invalid_date_format"
+	FieldFutureDate        = "future_date"
+	FieldInvalidTimeFormat = "invalid_time_format"
+	FieldInvalidTimeZone   = "invalid_time_zone"
+	FieldInvalidPrice      = "invalid_price_format"
+	FieldZeroPrice         = "zero_price"
+	FieldPatternMismatch   = "pattern_mismatch"
+	FieldInvalidValue      = "invalid_value"
+	FieldTotalMismatch     = "total_mismatch"
+	FieldSubtotalMismatch  = "subtotal_mismatch"
+	FieldPriceMismatch     = "price_mismatch"
+	FieldDiscountTooLarge  = "discount_exceeds_subtotal"
+)
+
+// FieldError describes why one field is invalid. Field is a path such as "items[2].price".
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error formats the field error as "field: message".
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Patterns from the receipt processor OpenAPI specification, `^[\w\s\-&]+$` and `^[\w\s\-]+$`,
+// with \w widened from ASCII to letters, marks and digits in any script so names such as
+// "Café Müller" are accepted
+var (
+	retailerPattern    = regexp.MustCompile(`^[\p{L}\p{M}\p{N}_\s\-&]+$`)
+	descriptionPattern = regexp.MustCompile(`^[\p{L}\p{M}\p{N}_\s\-]+$`)
+)
+
+// Validate runs every receipt check and returns all failures, in the order the fields appear
+// in a receipt, rather than stopping at the first. An empty result means the receipt is valid.
+func Validate(receipt model.Receipt) []FieldError {
+	return validate(receipt, nil)
+}
+
+// validate is Validate with a set of fields to leave out, used when those fields already failed to decode.
+func validate(receipt model.Receipt, skip map[string]bool) []FieldError {
+	var errs []FieldError
+	// Sums are meaningless when any amount failed to decode, so they are only checked when none did
+	checkSums := len(skip) == 0
+	add := func(field, code, message string) {
+		if !skip[field] {
+			errs = append(errs, FieldError{field, code, message})
+		}
+	}
+
+	// Check for a missing or malformed retailer
+	if receipt.Retailer == "" {
+		add("retailer", FieldMissing, "retailer is required")
+	} else if !retailerPattern.MatchString(receipt.Retailer) {
+		add("retailer", FieldPatternMismatch, "retailer may only contain letters, digits, spaces, '_', '-' and '&'")
+	}
+
+	// Check for an unknown time zone; the purchase date and time are local to it
+	location, err := receipt.Location()
+	if err != nil {
+		add("timeZone", FieldInvalidTimeZone, "timeZone must be an IANA time zone such as \"America/Chicago\"")
+	}
+
+	// Check for a missing, invalid or future date
+	validDate := false
+	if receipt.PurchaseDate == "" {
+		add("purchaseDate", FieldMissing, "purchaseDate is required")
+	} else if _, err := time.Parse("2006-01-02", receipt.PurchaseDate); err != nil {
+		add("purchaseDate", FieldInvalidDateFormat, "purchaseDate must be a date such as \"2022-01-01\"")
+	} else if location != nil && receipt.PurchaseDate > time.Now().In(location).Format("2006-01-02") {
+		// The date is compared with today's date where the purchase was made, not on the server
+		add("purchaseDate", FieldFutureDate, "purchaseDate cannot be in the future")
+	} else {
+		validDate = true
+	}
+
+	// Check for a missing, invalid or future time
+	if receipt.PurchaseTime == "" {
+		add("purchaseTime", FieldMissing, "purchaseTime is required")
+	} else if _, err := time.Parse("15:04", receipt.PurchaseTime); err != nil {
+		add("purchaseTime", FieldInvalidTimeFormat, "purchaseTime must be a 24-hour time such as \"13:01\"")
+	} else if purchasedAt, err := receipt.PurchasedAt(); validDate && receipt.TimeZone != "" && err == nil && purchasedAt.After(time.Now()) {
+		// Without a time zone the local time of day is unknown, so only the date is checked
+		add("purchaseTime", FieldFutureDate, "purchaseTime cannot be in the future")
+	}
+
+	// Amounts over MaxMoney can only come from receipts built in code; Decode rejects them earlier.
+	// Checking them first keeps the sums and products below from overflowing.
+	inRange := func(field string, amount model.Money) bool {
+		if amount > model.MaxMoney {
+			add(field, FieldInvalidValue, fmt.Sprintf("%s must be at most %s", field, model.MaxMoney))
+			return false
+		}
+		return true
+	}
+
+	if len(receipt.Items) == 0 {
+		add("items", FieldMissing, "at least one item is required")
+	} else if len(receipt.Items) > model.MaxLines {
+		add("items", FieldInvalidValue, fmt.Sprintf("items may list at most %d items", model.MaxLines))
+		checkSums = false
+	}
+	for i, item := range receipt.Items {
+		// Check for a missing or malformed description
+		field := fmt.Sprintf("items[%d].shortDescription", i)
+		if item.ShortDescription == "" {
+			add(field, FieldMissing, field+" is required")
+		} else if !descriptionPattern.MatchString(item.ShortDescription) {
+			add(field, FieldPatternMismatch, field+" may only contain letters, digits, spaces, '_' and '-'")
+		}
+
+		// Check for negative and zero prices in Items
+		field = fmt.Sprintf("items[%d].price", i)
+		priceField := field
+		if !model.IsValidPrice(item.Price.String()) {
+			add(field, FieldInvalidPrice, field+" cannot be negative")
+		} else if !inRange(field, item.Price) {
+			checkSums = false
+		} else if item.Price == 0 {
+			add(field, FieldZeroPrice, field+" must be greater than zero")
+		}
+
+		// Check for a quantity that is not a whole number from 1 to MaxQuantity
+		field = fmt.Sprintf("items[%d].quantity", i)
+		validQuantity := item.Quantity >= 0 && item.Quantity <= model.MaxQuantity
+		if !validQuantity {
+			add(field, FieldInvalidValue, fmt.Sprintf("%s must be a whole number from 1 to %d", field, model.MaxQuantity))
+		}
+
+		// Check that a unit price multiplied by the quantity gives the line price
+		if item.UnitPrice != nil {
+			field = fmt.Sprintf("items[%d].unitPrice", i)
+			if !model.IsValidPrice(item.UnitPrice.String()) {
+				add(field, FieldInvalidPrice, field+" cannot be negative")
+			} else if *item.UnitPrice == 0 {
+				add(field, FieldZeroPrice, field+" must be greater than zero")
+			} else if !inRange(field, *item.UnitPrice) {
+				checkSums = false
+			} else if expected := *item.UnitPrice * model.Money(item.Units()); checkSums && validQuantity && item.Price != expected {
+				add(priceField, FieldPriceMismatch, fmt.Sprintf("%s must equal quantity %d times unitPrice %s, %s", priceField, item.Units(), *item.UnitPrice, expected))
+			}
+		}
+	}
+
+	// Check that a stated subtotal is the sum of the items
+	if receipt.Subtotal != nil {
+		if !model.IsValidPrice(receipt.Subtotal.String()) {
+			add("subtotal", FieldInvalidPrice, "subtotal cannot be negative")
+		} else if !inRange("subtotal", *receipt.Subtotal) {
+			checkSums = false
+		} else if itemsTotal := receipt.ItemsTotal(); checkSums && *receipt.Subtotal != itemsTotal {
+			add("subtotal", FieldSubtotalMismatch, fmt.Sprintf("subtotal must equal the items sum of %s", itemsTotal))
+		}
+	}
+
+	// Check for negative and zero tax and discount amounts
+	checkLines := func(name string, lines []model.Line) {
+		if len(lines) > model.MaxLines {
+			add(name, FieldInvalidValue, fmt.Sprintf("%s may list at most %d lines", name, model.MaxLines))
+			checkSums = false
+		}
+		for i, line := range lines {
+			field := fmt.Sprintf("%s[%d].amount", name, i)
+			if !model.IsValidPrice(line.Amount.String()) {
+				add(field, FieldInvalidPrice, field+" cannot be negative")
+			} else if !inRange(field, line.Amount) {
+				checkSums = false
+			} else if line.Amount == 0 {
+				add(field, FieldZeroPrice, field+" must be greater than zero")
+			}
+		}
+	}
+	checkLines("taxes", receipt.Taxes)
+	checkLines("discounts", receipt.Discounts)
+
+	// Check that discounts do not take the receipt below zero before tax and tip
+	if preTax, _ := receipt.Amount(model.AmountPreTax); checkSums && preTax < 0 {
+		discount, _ := receipt.Amount(model.AmountDiscount)
+		subtotal, _ := receipt.Amount(model.AmountSubtotal)
+		add("discounts", FieldDiscountTooLarge, fmt.Sprintf("discounts of %s must not exceed the subtotal of %s", discount, subtotal))
+	}
+
+	// Check for a negative tip
+	if receipt.Tip != nil && !model.IsValidPrice(receipt.Tip.String()) {
+		add("tip", FieldInvalidPrice, "tip cannot be negative")
+	} else if receipt.Tip != nil && !inRange("tip", *receipt.Tip) {
+		checkSums = false
+	}
+
+	// Check for negative or zero total price
+	if !model.IsValidPrice(receipt.Total.String()) {
+		add("total", FieldInvalidPrice, "total cannot be negative")
+	} else if receipt.Total == 0 {
+		add("total", FieldZeroPrice, "total must be greater than zero")
+	} else if !inRange("total", receipt.Total) {
+		checkSums = false
+	} else if computed := receipt.ComputedTotal(); checkSums && receipt.HasLines() && receipt.Total != computed {
+		// An itemized receipt must add up exactly
+		add("total", FieldTotalMismatch, fmt.Sprintf("total must equal the items less discounts plus tax and tip, %s", computed))
+	}
+
+	return errs
+}
+
+// fieldRank orders receipt fields as they appear in a receipt, with items in index order.
+func fieldRank(field string) (int, int) {
+	var index int
+	switch {
+	case field == "retailer":
+		return 0, 0
+	case field == "purchaseDate":
+		return 1, 0
+	case field == "purchaseTime":
+		return 2, 0
+	case field == "timeZone":
+		return 2, 1
+	case field == "items":
+		return 3, 0
+	case strings.HasPrefix(field, "items["):
+		fmt.Sscanf(field, "items[%d]", &index)
+		return 4, index
+	case field == "subtotal":
+		return 5, 0
+	case field == "taxes":
+		return 6, -1
+	case strings.HasPrefix(field, "taxes["):
+		fmt.Sscanf(field, "taxes[%d]", &index)
+		return 6, index
+	case field == "discounts":
+		return 7, -1
+	case strings.HasPrefix(field, "discounts["):
+		fmt.Sscanf(field, "discounts[%d]", &index)
+		return 7, index
+	case field == "tip":
+		return 8, 0
+	case field == "total":
+		return 9, 0
+	}
+	return 10, 0
+}
+
+// Sort puts field errors in the order the fields appear in a receipt.
+func Sort(errs []FieldError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		ri, ii := fieldRank(errs[i].Field)
+		rj, ij := fieldRank(errs[j].Field)
+		if ri != rj {
+			return ri < rj
+		}
+		return ii < ij
+	})
+}
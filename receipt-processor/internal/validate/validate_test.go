@@ -0,0 +1,357 @@
+package validate_test
+
+import (
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/validate"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validReceipt() model.Receipt {
+	return model.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Items: []model.Item{
+			{ShortDescription: "Gatorade", Price: model.MustParseMoney("2.25")},
+			{ShortDescription: "Gatorade", Price: model.MustParseMoney("2.25")},
+		},
+		Total: model.MustParseMoney("4.50"),
+	}
+}
+
+// fieldCodes flattens field errors into "field:code" strings for comparison.
+func fieldCodes(errs []validate.FieldError) string {
+	var codes []string
+	for _, err := range errs {
+		codes = append(codes, err.Field+":"+err.Code)
+	}
+	return strings.Join(codes, ",")
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*model.Receipt)
+		want   string
+	}{
+		{
+			name:   "Valid receipt",
+			modify: func(*model.Receipt) {},
+			want:   "",
+		},
+		{
+			name:   "Retailer outside the spec pattern",
+			modify: func(r *model.Receipt) { r.Retailer = "Target!" },
+			want:   "retailer:" + validate.FieldPatternMismatch,
+		},
+		{
+			name: "Letters and digits in any script",
+			modify: func(r *model.Receipt) {
+				r.Retailer = "Café Müller & ローソン"
+				r.Items[0].ShortDescription = "Crème brûlée"
+			},
+			want: "",
+		},
+		{
+			name:   "Description outside the spec pattern",
+			modify: func(r *model.Receipt) { r.Items[1].ShortDescription = "Gatorade & Co" },
+			want:   "items[1].shortDescription:" + validate.FieldPatternMismatch,
+		},
+		{
+			name:   "Negative price",
+			modify: func(r *model.Receipt) { r.Items[0].Price = -225 },
+			want:   "items[0].price:" + validate.FieldInvalidPrice,
+		},
+		{
+			name:   "Zero total",
+			modify: func(r *model.Receipt) { r.Total = 0 },
+			want:   "total:" + validate.FieldZeroPrice,
+		},
+		{
+			name: "Every failure is collected in receipt order",
+			modify: func(r *model.Receipt) {
+				r.Retailer = ""
+				r.PurchaseDate = "2999-01-01"
+				r.PurchaseTime = "2:33pm"
+				r.Items[1].ShortDescription = ""
+				r.Items[1].Price = 0
+			},
+			want: "retailer:" + validate.FieldMissing +
+				",purchaseDate:" + validate.FieldFutureDate +
+				",purchaseTime:" + validate.FieldInvalidTimeFormat +
+				",items[1].shortDescription:" + validate.FieldMissing +
+				",items[1].price:" + validate.FieldZeroPrice,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := validReceipt()
+			tt.modify(&receipt)
+			if got := fieldCodes(validate.Validate(receipt)); got != tt.want {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLines(t *testing.T) {
+	money := func(price string) *model.Money {
+		m := model.MustParseMoney(price)
+		return &m
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*model.Receipt)
+		want   string
+	}{
+		{
+			name: "Lines that add up",
+			modify: func(r *model.Receipt) {
+				r.Subtotal = money("4.50")
+				r.Taxes = []model.Line{{Description: "Sales tax", Amount: model.MustParseMoney("0.36")}}
+				r.Discounts = []model.Line{{Description: "Coupon", Amount: model.MustParseMoney("1.00")}}
+				r.Tip = money("0.00")
+				r.Total = model.MustParseMoney("3.86")
+			},
+			want: "",
+		},
+		{
+			name: "Lines that do not add up",
+			modify: func(r *model.Receipt) {
+				r.Subtotal = money("4.00")
+				r.Taxes = []model.Line{{Amount: model.MustParseMoney("0.36")}}
+			},
+			want: "subtotal:" + validate.FieldSubtotalMismatch + ",total:" + validate.FieldTotalMismatch,
+		},
+		{
+			name: "Discounts above the subtotal",
+			modify: func(r *model.Receipt) {
+				r.Discounts = []model.Line{{Description: "Coupon", Amount: model.MustParseMoney("5.00")}}
+				r.Tip = money("10.00")
+				r.Total = model.MustParseMoney("9.50")
+			},
+			want: "discounts:" + validate.FieldDiscountTooLarge,
+		},
+		{
+			name: "Discounts of the whole subtotal",
+			modify: func(r *model.Receipt) {
+				r.Discounts = []model.Line{{Description: "Free lunch", Amount: model.MustParseMoney("4.50")}}
+				r.Tip = money("1.00")
+				r.Total = model.MustParseMoney("1.00")
+			},
+			want: "",
+		},
+		{
+			name: "Invalid line amounts",
+			modify: func(r *model.Receipt) {
+				r.Taxes = []model.Line{{Amount: 0}}
+				r.Discounts = []model.Line{{Amount: model.MustParseMoney("1.00")}, {Amount: -100}}
+				tip := model.Money(-1)
+				r.Tip = &tip
+			},
+			want: "taxes[0].amount:" + validate.FieldZeroPrice +
+				",discounts[1].amount:" + validate.FieldInvalidPrice +
+				",tip:" + validate.FieldInvalidPrice +
+				",total:" + validate.FieldTotalMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := validReceipt()
+			tt.modify(&receipt)
+			if got := fieldCodes(validate.Validate(receipt)); got != tt.want {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateQuantities(t *testing.T) {
+	unitPrice := model.MustParseMoney("2.25")
+	receipt := validReceipt()
+	receipt.Items = []model.Item{
+		{ShortDescription: "Gatorade", Price: model.MustParseMoney("6.75"), Quantity: 3, UnitPrice: &unitPrice},
+		{ShortDescription: "Gatorade", Price: model.MustParseMoney("2.25"), UnitPrice: &unitPrice},
+	}
+	receipt.Total = model.MustParseMoney("9.00")
+	if errs := validate.Validate(receipt); len(errs) != 0 {
+		t.Errorf("Validate() = %v, want no errors", errs)
+	}
+
+	receipt.Items[0].Quantity = 2
+	receipt.Items[1].Quantity = -1
+	want := "items[0].price:" + validate.FieldPriceMismatch + ",items[1].quantity:" + validate.FieldInvalidValue
+	if got := fieldCodes(validate.Validate(receipt)); got != want {
+		t.Errorf("Validate() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateTimeZone(t *testing.T) {
+	receipt := validReceipt()
+	// Local would be the server's zone, not the receipt's
+	for _, zone := range []string{"Mars/Olympus_Mons", "Local"} {
+		receipt.TimeZone = zone
+		if got, want := fieldCodes(validate.Validate(receipt)), "timeZone:"+validate.FieldInvalidTimeZone; got != want {
+			t.Errorf("Validate() = %q, want %q for %s", got, want, zone)
+		}
+	}
+
+	// Kiritimati is 25 hours ahead of Pago Pago, so the first minute of today there is already past,
+	// but in Pago Pago it is still a day or two away
+	kiritimati, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Fatalf("LoadLocation failed: %v", err)
+	}
+	receipt.PurchaseDate = time.Now().In(kiritimati).Format("2006-01-02")
+	receipt.PurchaseTime = "00:00"
+	receipt.TimeZone = "Pacific/Kiritimati"
+	if errs := validate.Validate(receipt); len(errs) != 0 {
+		t.Errorf("Validate() = %v, want no errors in Kiritimati", errs)
+	}
+	receipt.TimeZone = "Pacific/Pago_Pago"
+	if got, want := fieldCodes(validate.Validate(receipt)), "purchaseDate:"+validate.FieldFutureDate; got != want {
+		t.Errorf("Validate() = %q, want %q in Pago Pago", got, want)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	body := `{
+		"retailer": "Target",
+		"purchaseDate": "2022-13-01",
+		"purchaseTime": "13:01",
+		"items": [
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.4"},
+			{"shortDescription": "Emils Cheese Pizza", "price": "12.25", "quantity": 1.5},
+			{"shortDescription": "Knorr Creamy Chicken"}
+		],
+		"taxes": [{"description": "Sales tax", "amount": "0.5"}],
+		"total": "18.74"
+	}`
+	_, errs, err := validate.Decode(strings.NewReader(body), model.Zones{})
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	want := "purchaseDate:" + validate.FieldInvalidDateFormat +
+		",items[0].price:" + validate.FieldInvalidPrice +
+		",items[1].quantity:" + validate.FieldInvalidValue +
+		",items[2].price:" + validate.FieldMissing +
+		",taxes[0].amount:" + validate.FieldInvalidPrice
+	if got := fieldCodes(errs); got != want {
+		t.Errorf("Decode() field errors = %q, want %q", got, want)
+	}
+
+	if _, _, err := validate.Decode(strings.NewReader(`{"retailer": `), model.Zones{}); err == nil {
+		t.Error("Decode() of truncated JSON should fail")
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		item string
+		want string
+	}{
+		{"largest price", `{"shortDescription": "Car", "price": "10000000.00"}`, ""},
+		{"price over the limit", `{"shortDescription": "Car", "price": "10000000.01"}`, "items[0].price:" + validate.FieldInvalidValue},
+		{"price near int64", `{"shortDescription": "Car", "price": "92233720368547757.00"}`, "items[0].price:" + validate.FieldInvalidValue},
+		{"price over int64", `{"shortDescription": "Car", "price": "92233720368547758.08"}`, "items[0].price:" + validate.FieldInvalidValue},
+		{"largest quantity", `{"shortDescription": "Bolt", "price": "10000000.00", "quantity": 100000, "unitPrice": "100.00"}`, ""},
+		{"quantity over the limit", `{"shortDescription": "Bolt", "price": "10000010.00", "quantity": 100001, "unitPrice": "100.00"}`,
+			"items[0].price:" + validate.FieldInvalidValue + ",items[0].quantity:" + validate.FieldInvalidValue},
+		{"quantity near int64", `{"shortDescription": "Bolt", "price": "1.00", "quantity": 9223372036854775807, "unitPrice": "1.00"}`, "items[0].quantity:" + validate.FieldInvalidValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [` + tt.item + `], "total": "10000000.00"}`
+			_, errs, err := validate.Decode(strings.NewReader(body), model.Zones{})
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got := fieldCodes(errs); got != tt.want {
+				t.Errorf("Decode() field errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLimits(t *testing.T) {
+	// Receipts built in code can hold any amount, so Validate checks the limits too
+	receipt := validReceipt()
+	receipt.Items = []model.Item{
+		{ShortDescription: "Car", Price: model.MaxMoney},
+		{ShortDescription: "Car", Price: model.MaxMoney},
+	}
+	receipt.Total = model.MaxMoney
+	tax := model.MaxMoney
+	receipt.Taxes = []model.Line{{Amount: tax}}
+	if got, want := fieldCodes(validate.Validate(receipt)), "total:"+validate.FieldTotalMismatch; got != want {
+		t.Errorf("Validate() = %q, want %q", got, want)
+	}
+
+	// Two items at half the int64 range would wrap around to a negative sum
+	receipt.Items[0].Price = 50_000_000_000_000_000_00
+	receipt.Items[1].Price = 50_000_000_000_000_000_00
+	receipt.Items[1].Quantity = model.MaxQuantity + 1
+	want := "items[0].price:" + validate.FieldInvalidValue + ",items[1].price:" + validate.FieldInvalidValue + ",items[1].quantity:" + validate.FieldInvalidValue
+	if got := fieldCodes(validate.Validate(receipt)); got != want {
+		t.Errorf("Validate() = %q, want %q", got, want)
+	}
+
+	receipt = validReceipt()
+	receipt.Items = make([]model.Item, model.MaxLines+1)
+	for i := range receipt.Items {
+		receipt.Items[i] = model.Item{ShortDescription: "Gum", Price: 1}
+	}
+	if got, want := fieldCodes(validate.Validate(receipt)), "items:"+validate.FieldInvalidValue; got != want {
+		t.Errorf("Validate() = %q, want %q", got, want)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		tolerance string
+		total     string
+		mismatch  bool
+	}{
+		{"0.00", "4.50", false},
+		{"0.00", "4.51", true},
+		{"0.50", "5.00", false},
+		{"0.50", "3.99", true},
+		{"10%", "4.95", false},
+		{"10%", "4.96", true},
+		{"7.25%", "4.83", false},
+		{"7.25%", "4.84", true},
+		{"100%", "9.00", false},
+		{"100%", "9.01", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tolerance+" "+tt.total, func(t *testing.T) {
+			tolerance, err := validate.ParseTolerance(tt.tolerance)
+			if err != nil {
+				t.Fatalf("ParseTolerance(%q) error = %v", tt.tolerance, err)
+			}
+			if got := tolerance.String(); got != tt.tolerance {
+				t.Errorf("String() = %q, want %q", got, tt.tolerance)
+			}
+
+			receipt := validReceipt()
+			receipt.Total = model.MustParseMoney(tt.total)
+			if got := validate.Reconcile(receipt, tolerance); (got != nil) != tt.mismatch {
+				t.Errorf("Reconcile() = %+v, want mismatch %v", got, tt.mismatch)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "ten", "-1.00", "10.5.5%", "100.01%", "9999%", "10000000.01"} {
+		if _, err := validate.ParseTolerance(value); err == nil {
+			t.Errorf("ParseTolerance(%q) should fail", value)
+		}
+	}
+}